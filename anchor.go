@@ -0,0 +1,115 @@
+package filesman
+
+import (
+	"fmt"
+	"github.com/unidoc/unipdf/extractor"
+	pdf "github.com/unidoc/unipdf/model"
+	"strings"
+)
+
+const (
+	ANCHOR_FIRST = "first"
+	ANCHOR_LAST  = "last"
+	ANCHOR_EACH  = "each"
+)
+
+// AnchorError reports an anchor text found on none of the selected pages.
+type AnchorError struct {
+	Anchor string
+}
+
+func (err *AnchorError) Error() string {
+	return fmt.Sprintf("Anchor %q not found", err.Anchor)
+}
+
+// findAnchor returns the boxes of the anchor text on the page as displayed,
+// see pageFrame, as the text extractor works in the unrotated user space.
+func findAnchor(page *pdf.PdfPage, anchor string) ([]displayBox, error) {
+	ex, err := extractor.New(page)
+	if err != nil {
+		return nil, err
+	}
+	pageText, _, _, err := ex.ExtractPageText()
+	if err != nil {
+		return nil, err
+	}
+	frame, err := newPageFrame(page)
+	if err != nil {
+		return nil, err
+	}
+	text := pageText.Text()
+	marks := pageText.Marks()
+
+	var found []displayBox
+	for start := 0; ; {
+		i := strings.Index(text[start:], anchor)
+		if i < 0 {
+			break
+		}
+		offset := start + i
+		start = offset + len(anchor)
+
+		spanMarks, err := marks.RangeOffset(offset, offset+len(anchor))
+		if err != nil {
+			continue
+		}
+		bbox, ok := spanMarks.BBox()
+		if !ok {
+			continue
+		}
+		found = append(found, frame.displayedBox(bbox))
+	}
+	return found, nil
+}
+
+// anchorPositions finds the anchors of the placements on their selected
+// pages. For each anchored placement it maps page numbers to the matched
+// anchor boxes, placements without anchor get nil.
+func anchorPositions(pdfReader *pdf.PdfReader, placements []Placement, selectedPages [][]int) ([]map[int][]displayBox, error) {
+	positions := make([]map[int][]displayBox, len(placements))
+	cache := make(map[string][]displayBox)
+	for i, placement := range placements {
+		if placement.Anchor == "" {
+			continue
+		}
+
+		type match struct {
+			page int
+			box  displayBox
+		}
+		var matches []match
+		for _, n := range selectedPages[i] {
+			key := fmt.Sprintf("%d:%s", n, placement.Anchor)
+			found, ok := cache[key]
+			if !ok {
+				page, err := pdfReader.GetPage(n)
+				if err != nil {
+					return nil, err
+				}
+				found, err = findAnchor(page, placement.Anchor)
+				if err != nil {
+					return nil, err
+				}
+				cache[key] = found
+			}
+			for _, box := range found {
+				matches = append(matches, match{n, box})
+			}
+		}
+		if len(matches) == 0 {
+			return nil, &AnchorError{Anchor: placement.Anchor}
+		}
+
+		switch placement.AnchorMatch {
+		case "", ANCHOR_FIRST:
+			matches = matches[:1]
+		case ANCHOR_LAST:
+			matches = matches[len(matches)-1:]
+		}
+		positions[i] = make(map[int][]displayBox)
+		for _, m := range matches {
+			positions[i][m.page] = append(positions[i][m.page], m.box)
+		}
+	}
+	return positions, nil
+}
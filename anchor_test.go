@@ -0,0 +1,132 @@
+package filesman
+
+import (
+	"bytes"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"math"
+	"testing"
+)
+
+func TestDisplayedBox(t *testing.T) {
+	page := pdf.PdfRectangle{Llx: 0, Lly: 0, Urx: 600, Ury: 800}
+	text := pdf.PdfRectangle{Llx: 100, Lly: 700, Urx: 200, Ury: 720}
+	tests := []struct {
+		rotate int
+		box    displayBox
+	}{
+		{0, displayBox{left: 100, top: 80, right: 200, bottom: 100}},
+		{90, displayBox{left: 700, top: 100, right: 720, bottom: 200}},
+		{180, displayBox{left: 400, top: 700, right: 500, bottom: 720}},
+		{270, displayBox{left: 80, top: 400, right: 100, bottom: 500}},
+	}
+	for _, test := range tests {
+		f := &pageFrame{mbox: page, box: page, rotate: test.rotate}
+		box := f.displayedBox(text)
+		if box != test.box {
+			t.Errorf("rotate %d: %+v, want %+v", test.rotate, box, test.box)
+		}
+		// creatorPoint maps the box back onto a corner of the text
+		x, y := f.creatorPoint(box.left, box.top)
+		ux, uy := x+page.Llx, page.Ury-y
+		if (ux != text.Llx && ux != text.Urx) || (uy != text.Lly && uy != text.Ury) {
+			t.Errorf("rotate %d: upper left corner maps to %v %v", test.rotate, ux, uy)
+		}
+	}
+}
+
+func TestLayoutInAnchor(t *testing.T) {
+	page := pdf.PdfRectangle{Llx: 0, Lly: 0, Urx: 600, Ury: 800}
+	box := displayBox{left: 100, top: 80, right: 200, bottom: 100}
+	tests := []struct {
+		origin string
+		px, py float64 // displayed point a zero sized stamp lands on
+	}{
+		{"", 110, 100},
+		{ORIGIN_TOP_RIGHT, 190, 100},
+		{ORIGIN_BOTTOM_LEFT, 110, 80},
+		{ORIGIN_BOTTOM_RIGHT, 190, 80},
+		{ORIGIN_CENTER, 160, 70},
+	}
+	for _, rotate := range []int{0, 90, 180, 270} {
+		f := &pageFrame{mbox: page, box: page, rotate: rotate}
+		for _, test := range tests {
+			placement := &Placement{Xpos: 10, Ypos: 20, Origin: test.origin}
+			x, y, angle := f.layoutIn(placement, box, 0, 0)
+			wx, wy := f.creatorPoint(test.px, test.py)
+			if math.Abs(x-wx) > 1e-9 || math.Abs(y-wy) > 1e-9 || angle != float64(rotate) {
+				t.Errorf("rotate %d origin %q: %v %v %v, want %v %v", rotate, test.origin, x, y, angle, wx, wy)
+			}
+		}
+	}
+}
+
+// testRotatedPdf returns a one page pdf rotated by rotate with text at x, y
+// in creator coordinates of the unrotated page.
+func testRotatedPdf(t *testing.T, rotate int64, text string, x, y float64) []byte {
+	c := creator.New()
+	page := c.NewPage()
+	page.Rotate = &rotate
+	p := c.NewParagraph(text)
+	p.SetFontSize(12)
+	p.SetPos(x, y)
+	if err := c.Draw(p); err != nil {
+		t.Fatal(err)
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := c.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// testFindText returns the displayed box of the only occurrence of text on
+// the first page of the pdf.
+func testFindText(t *testing.T, pdfData []byte, text string) displayBox {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := pdfReader.GetPage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := findAnchor(page, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("%q found %d times", text, len(found))
+	}
+	return found[0]
+}
+
+func TestStampAnchorRotatedPage(t *testing.T) {
+	first, err := ParsePageSelector("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rotate := range []int64{0, 90, 180, 270} {
+		pdfData := testRotatedPdf(t, rotate, "SIGN HERE", 150, 200)
+		anchor := testFindText(t, pdfData, "SIGN HERE")
+
+		out, err := StampPdf(pdfData, []Placement{
+			{Type: STAMP_TEXT, Text: "BELOW", Page: first, Anchor: "SIGN HERE", Xpos: 10, Ypos: 30},
+			{Type: STAMP_TEXT, Text: "RIGHT", Page: first, Anchor: "SIGN HERE", Ypos: 60, Origin: ORIGIN_TOP_RIGHT},
+		}, nil, StampOptions{})
+		if err != nil {
+			t.Fatalf("rotate %d: %v", rotate, err)
+		}
+
+		// same font and size as the anchor, so the glyph boxes are offset
+		// as the paragraphs are
+		below := testFindText(t, out, "BELOW")
+		if math.Abs(below.left-anchor.left-10) > 1.5 || math.Abs(below.top-anchor.top-30) > 1.5 {
+			t.Errorf("rotate %d: BELOW at %+v, anchor at %+v", rotate, below, anchor)
+		}
+		right := testFindText(t, out, "RIGHT")
+		if math.Abs(right.right-anchor.right) > 1.5 || math.Abs(right.top-anchor.top-60) > 1.5 {
+			t.Errorf("rotate %d: RIGHT at %+v, anchor at %+v", rotate, right, anchor)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package filesman
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shellow/keyman"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const AUDITDIR = ".audit"
+
+const (
+	AUDIT_PAGE_MARGIN = 50
+	AUDIT_FONT_SIZE   = 10
+	AUDIT_TIME_FORMAT = "2006-01-02 15:04:05 MST"
+)
+
+// auditLock serializes appends to the audit logs.
+var auditLock sync.Mutex
+
+// AuditPlacement is a placement as recorded in the audit trail.
+type AuditPlacement struct {
+	Type  string  `json:"type"`
+	Seal  string  `json:"seal,omitempty"`
+	Image string  `json:"image,omitempty"`
+	Text  string  `json:"text,omitempty"`
+	Page  string  `json:"page"`  // the selector
+	Pages []int   `json:"pages"` // selected, or searched for the anchor
+	Xpos  float64 `json:"xpos"`
+	Ypos  float64 `json:"ypos"`
+	Width float64 `json:"width"`
+}
+
+// AuditRecord records a stamping. The result digests cover the stamped pdf
+// with its audit page, which shows the record ID to look them up by.
+type AuditRecord struct {
+	ID           string           `json:"id"`
+	Time         time.Time        `json:"time"`
+	Addr         string           `json:"addr"` // of the signer
+	Source       string           `json:"source"`
+	SourceTime   time.Time        `json:"sourcetime"` // of the upload
+	SourceSha256 string           `json:"sourcesha256"`
+	SourceSm3    string           `json:"sourcesm3"`
+	Result       string           `json:"result"`
+	ResultSha256 string           `json:"resultsha256"`
+	ResultSm3    string           `json:"resultsm3"`
+	Placements   []AuditPlacement `json:"placements"`
+}
+
+// NewAuditRecord records the stamping of source by addr with the
+// placements, numPages being the page count of the pdf.
+func NewAuditRecord(addr string, source string, sourceTime time.Time, pdfData []byte, placements []Placement, numPages int) (*AuditRecord, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	record := &AuditRecord{
+		ID:         hex.EncodeToString(id),
+		Time:       time.Now(),
+		Addr:       addr,
+		Source:     source,
+		SourceTime: sourceTime,
+		Placements: []AuditPlacement{},
+	}
+	record.SourceSha256, record.SourceSm3 = sourceHashes(pdfData)
+	for _, placement := range placements {
+		p := AuditPlacement{
+			Type:  placement.Type,
+			Seal:  placement.Seal,
+			Text:  placement.Text,
+			Page:  placement.Page.String(),
+			Xpos:  placement.Xpos,
+			Ypos:  placement.Ypos,
+			Width: placement.Width,
+		}
+		if p.Type == "" {
+			p.Type = STAMP_IMAGE
+		}
+		if p.Seal == "" {
+			p.Image = placement.Image
+		}
+		p.Pages, _ = placement.Page.Pages(numPages)
+		record.Placements = append(record.Placements, p)
+	}
+	return record, nil
+}
+
+func (p AuditPlacement) String() string {
+	var what string
+	switch {
+	case p.Seal != "":
+		what = fmt.Sprintf("seal %q", p.Seal)
+	case p.Type == STAMP_QR && p.Text == "":
+		what = "qr code"
+	case p.Type == STAMP_TEXT || p.Type == STAMP_QR:
+		what = fmt.Sprintf("%s %q", p.Type, p.Text)
+	default:
+		what = fmt.Sprintf("%s %s", p.Type, p.Image)
+	}
+	pages := make([]string, len(p.Pages))
+	for i, n := range p.Pages {
+		pages[i] = strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%s on pages %s at %g, %g width %g", what, strings.Join(pages, ","), p.Xpos, p.Ypos, p.Width)
+}
+
+// auditLines returns the text of the audit page.
+func auditLines(record *AuditRecord) []string {
+	lines := []string{
+		"Record: " + record.ID,
+		"Document: " + record.Source,
+		"Uploaded: " + record.SourceTime.Format(AUDIT_TIME_FORMAT),
+		"Source SHA-256: " + record.SourceSha256,
+		"Source SM3: " + record.SourceSm3,
+		"Signer: " + record.Addr,
+		"Stamped: " + record.Time.Format(AUDIT_TIME_FORMAT),
+		"",
+		"Placements:",
+	}
+	for i, p := range record.Placements {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, p))
+	}
+	lines = append(lines, "",
+		"The digests of this document are kept in the audit trail under the record above.")
+	return lines
+}
+
+// AppendAuditPage appends pages listing the audit record to the pdf.
+func AppendAuditPage(pdfData []byte, record *AuditRecord, fontdir string, fontname string) ([]byte, error) {
+	font, err := loadFont(fontdir, fontname)
+	if err != nil {
+		return nil, err
+	}
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	c := creator.New()
+	for i := 1; i <= numPages; i++ {
+		page, err := pdfReader.GetPage(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+
+	size := creator.PageSizeA4
+	c.SetPageSize(size)
+	c.NewPage()
+	y := float64(AUDIT_PAGE_MARGIN)
+	draw := func(text string, fontsize float64) error {
+		p := c.NewParagraph(text)
+		p.SetFont(font)
+		p.SetFontSize(fontsize)
+		p.SetEnableWrap(true)
+		p.SetWidth(size[0] - 2*AUDIT_PAGE_MARGIN)
+		if y+p.Height() > size[1]-AUDIT_PAGE_MARGIN {
+			c.NewPage()
+			y = AUDIT_PAGE_MARGIN
+		}
+		p.SetPos(AUDIT_PAGE_MARGIN, y)
+		y += p.Height() + fontsize/2
+		return c.Draw(p)
+	}
+	if err := draw("Signing Certificate", 2*AUDIT_FONT_SIZE); err != nil {
+		return nil, err
+	}
+	for _, line := range auditLines(record) {
+		if err := draw(line, AUDIT_FONT_SIZE); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (filesman *Filesman) auditPath(addr string) string {
+	return filepath.Join(filesman.Filedir, AUDITDIR, addr+".jsonl")
+}
+
+// AddAuditRecord appends the record to the audit trail of addr.
+func (filesman *Filesman) AddAuditRecord(addr string, record *AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	if err := os.MkdirAll(filepath.Join(filesman.Filedir, AUDITDIR), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filesman.auditPath(addr), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// AuditQuery selects audit records, empty fields matching any. File
+// matches the source or the result name.
+type AuditQuery struct {
+	ID    string
+	File  string
+	Since time.Time
+	Until time.Time
+}
+
+func (query *AuditQuery) match(record *AuditRecord) bool {
+	if query.ID != "" && record.ID != query.ID {
+		return false
+	}
+	if query.File != "" && record.Source != query.File && record.Result != query.File {
+		return false
+	}
+	if !query.Since.IsZero() && record.Time.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && record.Time.After(query.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditRecords returns the audit records of addr matching the query, oldest
+// first.
+func (filesman *Filesman) AuditRecords(addr string, query AuditQuery) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	f, err := os.Open(filesman.auditPath(addr))
+	if os.IsNotExist(err) {
+		return records, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		if query.match(&record) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Audit returns the audit records of the caller selected by the id, file,
+// since and until parameters, the times in RFC 3339.
+func (filesman *Filesman) Audit(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	addr, err := keyman.TokenToAddrStr(c.GetHeader("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+		return
+	}
+	query := AuditQuery{ID: c.Query("id"), File: c.Query("file")}
+	if since := c.Query("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Params since error",
+			})
+			return
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Params until error",
+			})
+			return
+		}
+	}
+
+	records, err := filesman.AuditRecords(addr, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not read audit trail",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"records": records,
+	})
+}
@@ -0,0 +1,90 @@
+package filesman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const ENCODING_GZIP = "gzip"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsCompressed reports whether stored data is gzip compressed. None of the
+// accepted upload types start with the gzip magic.
+func IsCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+func Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// AcceptsEncoding reports whether an Accept-Encoding header allows encoding.
+// Entries naming the encoding decide over "*", q values of 0 or below, or
+// invalid ones, refuse.
+func AcceptsEncoding(header string, encoding string) bool {
+	var named, wildcard []float64
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.TrimSpace(fields[0])
+		q := 1.0
+		for _, param := range fields[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil {
+				v = 0
+			}
+			q = v
+		}
+		if strings.EqualFold(name, encoding) {
+			named = append(named, q)
+		} else if name == "*" {
+			wildcard = append(wildcard, q)
+		}
+	}
+	qs := named
+	if len(qs) == 0 {
+		qs = wildcard
+	}
+	for _, q := range qs {
+		if !(q > 0) {
+			return false
+		}
+	}
+	return len(qs) > 0
+}
+
+func (filesman *Filesman) shouldCompress(filetype string) bool {
+	for _, t := range filesman.CompressTypes {
+		if strings.EqualFold(t, filetype) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package filesman
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"mime"
+)
+
+// End-to-end encrypted blobs are produced and opened by the client only, the
+// server stores them as opaque files with the E2E_EXT extension. Rather than
+// a key derived from the user's keyman key, they use a separate SM2 key,
+// read from a PEM file by LoadE2EKey. It stays apart from the key that
+// signs in to the server and can be backed up or given to other devices
+// by itself. Each blob has a random SM4 key, wrapped with SM2.
+const (
+	E2E_EXT  = ".e2e"
+	E2E_TYPE = "application/x-filesman-e2e"
+)
+
+var e2eMagic = []byte("FME2E2")
+
+func init() {
+	_ = mime.AddExtensionType(E2E_EXT, E2E_TYPE)
+}
+
+// IsE2E reports whether data is a blob written by EncryptE2E.
+func IsE2E(data []byte) bool {
+	return bytes.HasPrefix(data, e2eMagic)
+}
+
+// LoadE2EKey reads the user's SM2 private key of end-to-end encryption from
+// pem, pwd opening an encrypted one.
+func LoadE2EKey(keyPem []byte, pwd []byte) (*sm2.PrivateKey, error) {
+	if len(pwd) == 0 {
+		pwd = nil
+	}
+	return smx509.ReadPrivateKeyFromPem(keyPem, pwd)
+}
+
+// EncryptE2E seals the file name and data with sm4-gcm under a random key,
+// which is stored with the blob encrypted to the user's SM2 public key.
+func EncryptE2E(pub *sm2.PublicKey, name string, data []byte) ([]byte, error) {
+	if pub == nil {
+		return nil, errors.New("no key")
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := sm2.Encrypt(pub, key, rand.Reader, sm2.C1C3C2)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(encSM4, key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := new(bytes.Buffer)
+	_ = binary.Write(plain, binary.BigEndian, uint16(len(name)))
+	plain.WriteString(name)
+	plain.Write(data)
+	sealed, err := seal(aead, plain.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	blob := new(bytes.Buffer)
+	blob.Write(e2eMagic)
+	_ = binary.Write(blob, binary.BigEndian, uint16(len(wrapped)))
+	blob.Write(wrapped)
+	blob.Write(sealed)
+	return blob.Bytes(), nil
+}
+
+// DecryptE2E opens a blob written by EncryptE2E with the user's SM2 private
+// key and returns the original file name and data.
+func DecryptE2E(priv *sm2.PrivateKey, blob []byte) (string, []byte, error) {
+	if !IsE2E(blob) {
+		return "", nil, errors.New("not an e2e blob")
+	}
+	blob = blob[len(e2eMagic):]
+	if len(blob) < 2 {
+		return "", nil, errors.New("invalid e2e blob")
+	}
+	wlen := int(binary.BigEndian.Uint16(blob))
+	if len(blob) < 2+wlen {
+		return "", nil, errors.New("invalid e2e blob")
+	}
+	key, err := sm2.Decrypt(priv, blob[2:2+wlen], sm2.C1C3C2)
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := newGCM(encSM4, key)
+	if err != nil {
+		return "", nil, err
+	}
+	plain, err := unseal(aead, blob[2+wlen:])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(plain) < 2 {
+		return "", nil, errors.New("invalid e2e blob")
+	}
+	nlen := int(binary.BigEndian.Uint16(plain))
+	if len(plain) < 2+nlen {
+		return "", nil, errors.New("invalid e2e blob")
+	}
+	return string(plain[2 : 2+nlen]), plain[2+nlen:], nil
+}
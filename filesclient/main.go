@@ -3,17 +3,22 @@ package main
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/prometheus/common/log"
 	"github.com/shellow/filesman"
 	"github.com/tidwall/gjson"
+	"github.com/tjfoc/gmsm/sm2"
 	"github.com/urfave/cli"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -60,6 +65,19 @@ func main() {
 					Name:  "file, f",
 					Usage: "file for upload",
 				},
+				cli.BoolFlag{
+					Name:  "encrypt, e",
+					Usage: "encrypt file end-to-end before upload",
+				},
+				cli.StringFlag{
+					Name:   "keyfile, k",
+					EnvVar: "FILESMAN_E2E_KEYFILE",
+					Usage:  "SM2 private key pem for end-to-end encryption, its password in FILESMAN_E2E_KEYPASS",
+				},
+				cli.StringFlag{
+					Name:  "ttl",
+					Usage: "expire file after ttl, e.g. 72h",
+				},
 			},
 		},
 		{
@@ -77,6 +95,216 @@ func main() {
 					Value: "./",
 					Usage: "file dir for save",
 				},
+				cli.BoolFlag{
+					Name:  "encrypt, e",
+					Usage: "decrypt end-to-end encrypted file after download",
+				},
+				cli.StringFlag{
+					Name:   "keyfile, k",
+					EnvVar: "FILESMAN_E2E_KEYFILE",
+					Usage:  "SM2 private key pem for end-to-end encryption, its password in FILESMAN_E2E_KEYPASS",
+				},
+			},
+		},
+		{
+			Name:     "audit",
+			Usage:    "list the audit trail of stampings",
+			Category: "act",
+			Action:   audit,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "source or result file",
+				},
+				cli.StringFlag{
+					Name:  "id",
+					Usage: "record id shown on the signing certificate page",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "RFC 3339 time, e.g. 2024-01-01T00:00:00Z",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "RFC 3339 time",
+				},
+			},
+		},
+		{
+			Name:     "inspect",
+			Usage:    "show pages, info, fields and signatures of a stored pdf",
+			Category: "act",
+			Action:   inspect,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "stored pdf to inspect",
+				},
+			},
+		},
+		{
+			Name:     "timestamp",
+			Usage:    "download file timestamp token",
+			Category: "act",
+			Action:   timestamp,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "file for timestamp",
+				},
+				cli.StringFlag{
+					Name:  "sdir, d",
+					Value: "./",
+					Usage: "token dir for save",
+				},
+			},
+		},
+		{
+			Name:     "merge",
+			Usage:    "merge stored pdf and image files into a stored pdf",
+			Category: "act",
+			Action:   merge,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "file, f",
+					Usage: "stored file in merge order, pdf pages as name:pages, e.g. a.pdf:1-3",
+				},
+			},
+		},
+		{
+			Name:     "split",
+			Usage:    "split a stored pdf into stored pdfs",
+			Category: "act",
+			Action:   split,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf to split",
+				},
+				cli.StringFlag{
+					Name:  "mode, m",
+					Value: "pages",
+					Usage: "pages, every or bookmarks",
+				},
+				cli.StringFlag{
+					Name:  "pages, p",
+					Usage: "pages to extract in pages mode, e.g. 1-3,5",
+				},
+				cli.IntFlag{
+					Name:  "n",
+					Usage: "pages per pdf in every mode",
+				},
+			},
+		},
+		{
+			Name:     "editpages",
+			Usage:    "rotate, delete, move and insert pages of a stored pdf",
+			Category: "act",
+			Action:   editpages,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf to edit",
+				},
+				cli.StringFlag{
+					Name:  "edits, e",
+					Usage: `edits as json, e.g. [{"op":"rotate","page":3,"angle":90},{"op":"delete","page":5}]`,
+				},
+			},
+		},
+		{
+			Name:     "imagestopdf",
+			Usage:    "convert stored images into a stored pdf",
+			Category: "act",
+			Action:   imagestopdf,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "image, i",
+					Usage: "stored image in page order",
+				},
+				cli.StringFlag{
+					Name:  "size, s",
+					Value: "a4",
+					Usage: "a4, letter or fit",
+				},
+				cli.StringFlag{
+					Name:  "orientation, o",
+					Value: "auto",
+					Usage: "auto, portrait or landscape",
+				},
+				cli.StringFlag{
+					Name:  "margin, m",
+					Usage: "margin in points",
+				},
+			},
+		},
+		{
+			Name:     "fillform",
+			Usage:    "fill in the form fields of a stored pdf",
+			Category: "act",
+			Action:   fillform,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf form",
+				},
+				cli.StringFlag{
+					Name:  "fields",
+					Usage: `field values as json, e.g. {"name":"Zhang San","agree":true}`,
+				},
+				cli.BoolFlag{
+					Name:  "flatten",
+					Usage: "make the fields part of the pages",
+				},
+				cli.StringFlag{
+					Name:  "font",
+					Usage: "font for the filled in text",
+				},
+			},
+		},
+		{
+			Name:     "encrypt",
+			Usage:    "password protect a stored pdf",
+			Category: "act",
+			Action:   encrypt,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf to encrypt",
+				},
+				cli.StringFlag{
+					Name:  "userpass",
+					Usage: "password to open the pdf",
+				},
+				cli.StringFlag{
+					Name:  "ownerpass",
+					Usage: "password granting all permissions",
+				},
+				cli.StringFlag{
+					Name:  "permissions",
+					Value: "print,printhq",
+					Usage: "granted by userpass: print printhq modify copy accessibility annotate fillforms assemble, all or none",
+				},
+				cli.StringFlag{
+					Name:  "password",
+					Usage: "owner password of a pdf encrypted already",
+				},
+			},
+		},
+		{
+			Name:     "decrypt",
+			Usage:    "remove the password protection of a stored pdf",
+			Category: "act",
+			Action:   decrypt,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf to decrypt",
+				},
+				cli.StringFlag{
+					Name:  "password",
+					Usage: "owner password, the user password does not grant removing the protection",
+				},
 			},
 		},
 		{
@@ -98,9 +326,167 @@ func main() {
 					Name:  "image, i",
 					Usage: "image file for upload",
 				},
+				cli.StringFlag{
+					Name:  "seal",
+					Usage: "name of a registered seal, instead of image",
+				},
+				cli.StringFlag{
+					Name:  "page",
+					Usage: "pages in pdf file, e.g. 1,3-5 last odd even -2 all-but-first, -1 for all",
+				},
+				cli.StringFlag{
+					Name:  "xpos, x",
+					Usage: "xpos to image file",
+				},
+				cli.StringFlag{
+					Name:  "ypos, y",
+					Usage: "ypos to image file",
+				},
+				cli.StringFlag{
+					Name:  "width, w",
+					Usage: "width to image file",
+				},
+				cli.StringFlag{
+					Name:  "placements",
+					Usage: `json placements, e.g. [{"image":"seal","page":-1,"xpos":400,"ypos":700,"width":100}]`,
+				},
+				cli.StringSliceFlag{
+					Name:  "images",
+					Usage: "named image files for placements, as name=path",
+				},
+				cli.BoolFlag{
+					Name:  "store",
+					Usage: "store the result on the server instead of downloading it",
+				},
+				cli.StringFlag{
+					Name:  "password",
+					Usage: "password of an encrypted pdf",
+				},
+			},
+		},
+		{
+			Name:     "sealregister",
+			Usage:    "register a seal image under a name",
+			Category: "act",
+			Action:   sealregister,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "seal name, letters, digits, _ . and -",
+				},
+				cli.StringFlag{
+					Name:  "image, i",
+					Usage: "seal image file for upload",
+				},
+				cli.StringFlag{
+					Name:  "width, w",
+					Usage: "default width of placements, 100 by default",
+				},
+				cli.StringFlag{
+					Name:  "opacity",
+					Usage: "default opacity of placements, 0 to 1, opaque by default",
+				},
+			},
+		},
+		{
+			Name:     "seals",
+			Usage:    "list the registered seals",
+			Category: "act",
+			Action:   seals,
+		},
+		{
+			Name:     "sealdisable",
+			Usage:    "disable a registered seal",
+			Category: "act",
+			Action:   sealdisable,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, n",
+					Usage: "seal name",
+				},
+				cli.BoolFlag{
+					Name:  "enable",
+					Usage: "enable the seal again",
+				},
+			},
+		},
+		{
+			Name:     "watermark",
+			Usage:    "watermark a stored pdf with text or a stored image into a stored pdf",
+			Category: "act",
+			Action:   watermark,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf to watermark",
+				},
+				cli.StringFlag{
+					Name:  "text, t",
+					Usage: "watermark text, may use {addr} {time} {date} {page} {pages} {sha256} {sm3}",
+				},
+				cli.StringFlag{
+					Name:  "image, i",
+					Usage: "stored image, used without text",
+				},
+				cli.StringFlag{
+					Name:  "font",
+					Usage: "font of the text",
+				},
+				cli.StringFlag{
+					Name:  "fontsize",
+					Usage: "font size of the text, 48 by default",
+				},
+				cli.StringFlag{
+					Name:  "color",
+					Usage: "text color as #rrggbb, gray by default",
+				},
+				cli.StringFlag{
+					Name:  "width, w",
+					Usage: "image width, half the page width by default",
+				},
+				cli.StringFlag{
+					Name:  "opacity",
+					Usage: "0 to 1, 0.3 by default",
+				},
+				cli.StringFlag{
+					Name:  "angle",
+					Usage: "degrees counter-clockwise, 45 by default",
+				},
+				cli.BoolFlag{
+					Name:  "tile",
+					Usage: "tile the watermark over the pages",
+				},
+				cli.StringFlag{
+					Name:  "spacing",
+					Usage: "gap between tiles, 40 by default",
+				},
+				cli.StringFlag{
+					Name:  "page",
+					Usage: "pages to watermark, e.g. 1,3-5 odd all-but-first, all by default",
+				},
+			},
+		},
+		{
+			Name:     "stamp",
+			Usage:    "stamp a stored pdf with stored images or seals into a stored pdf",
+			Category: "act",
+			Action:   stamp,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "pdf",
+					Usage: "stored pdf to stamp",
+				},
+				cli.StringFlag{
+					Name:  "image, i",
+					Usage: "stored image",
+				},
+				cli.StringFlag{
+					Name:  "seal",
+					Usage: "name of a registered seal, instead of image",
+				},
 				cli.StringFlag{
 					Name:  "page",
-					Usage: "page in pdf file",
+					Usage: "pages in pdf file, e.g. 1,3-5 last odd even -2 all-but-first, -1 for all",
 				},
 				cli.StringFlag{
 					Name:  "xpos, x",
@@ -114,6 +500,22 @@ func main() {
 					Name:  "width, w",
 					Usage: "width to image file",
 				},
+				cli.StringFlag{
+					Name:  "placements",
+					Usage: "json placements, images naming stored files",
+				},
+				cli.BoolFlag{
+					Name:  "audit",
+					Usage: "append a signing certificate page and record the stamping in the audit trail",
+				},
+				cli.StringFlag{
+					Name:  "auditfont",
+					Usage: "font of the signing certificate page",
+				},
+				cli.StringFlag{
+					Name:  "password",
+					Usage: "password of an encrypted pdf",
+				},
 			},
 		},
 	}
@@ -124,6 +526,20 @@ func main() {
 	}
 }
 
+// e2eKey loads the SM2 key of end-to-end encryption named by the keyfile
+// flag.
+func e2eKey(c *cli.Context) (*sm2.PrivateKey, error) {
+	keyfile := c.String("keyfile")
+	if keyfile == "" {
+		return nil, errors.New("no keyfile for end-to-end encryption")
+	}
+	keyPem, err := ioutil.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+	return filesman.LoadE2EKey(keyPem, []byte(os.Getenv("FILESMAN_E2E_KEYPASS")))
+}
+
 func head(c *cli.Context) (key, value string) {
 	head := c.GlobalString("head")
 	kv := strings.Split(head, ":")
@@ -155,9 +571,30 @@ func upload(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	if _, err = io.Copy(fw, f); err != nil {
+	if c.Bool("encrypt") {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		key, err := e2eKey(c)
+		if err != nil {
+			return err
+		}
+		blob, err := filesman.EncryptE2E(&key.PublicKey, filepath.Base(file), data)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(blob); err != nil {
+			return err
+		}
+	} else if _, err = io.Copy(fw, f); err != nil {
 		return err
 	}
+	if ttl := c.String("ttl"); ttl != "" {
+		if err = w.WriteField("ttl", ttl); err != nil {
+			return err
+		}
+	}
 	// Don't forget to close the multipart writer.
 	// If you don't close it, your request will be missing the terminating boundary.
 	w.Close()
@@ -230,20 +667,41 @@ func download(c *cli.Context) error {
 	}
 
 	sdir := c.String("sdir")
-	// 	f, err := os.Create(filePath)
-	fpath := filepath.Join(sdir, file)
-	f, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return err
-	}
-	io.Copy(f, res.Body)
-	fmt.Println("success")
-	return nil
-}
-
-func imgaddpdf(c *cli.Context) error {
+	if c.Bool("encrypt") {
+		blob, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		key, err := e2eKey(c)
+		if err != nil {
+			return err
+		}
+		name, data, err := filesman.DecryptE2E(key, blob)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(sdir, filepath.Base(name)), data, 0666)
+		if err != nil {
+			return err
+		}
+		fmt.Println("success")
+		return nil
+	}
+
+	// 	f, err := os.Create(filePath)
+	fpath := filepath.Join(sdir, file)
+	f, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	io.Copy(f, res.Body)
+	fmt.Println("success")
+	return nil
+}
+
+func imgaddpdf(c *cli.Context) error {
 	murl := c.GlobalString("surl")
-	murl = murl + "/files/imgsignpdfonce"
+	murl = murl + "/files/imgsignpdf"
 	pdf := c.String("pdf")
 	pdff, err := os.Open(pdf)
 	if err != nil {
@@ -253,13 +711,6 @@ func imgaddpdf(c *cli.Context) error {
 
 	file := c.String("file")
 
-	img := c.String("image")
-	imgf, err := os.Open(img)
-	if err != nil {
-		return err
-	}
-	defer imgf.Close()
-
 	var b bytes.Buffer
 	w := multipart.NewWriter(&b)
 
@@ -271,12 +722,42 @@ func imgaddpdf(c *cli.Context) error {
 		return err
 	}
 
-	fw1, err := w.CreateFormFile("image", img)
-	if err != nil {
-		return err
+	if img := c.String("image"); img != "" {
+		err = addFormFile(w, "image", img)
+		if err != nil {
+			return err
+		}
 	}
-	if _, err = io.Copy(fw1, imgf); err != nil {
-		return err
+
+	if seal := c.String("seal"); seal != "" {
+		err = w.WriteField("seal", seal)
+		if err != nil {
+			return err
+		}
+	}
+
+	if password := c.String("password"); password != "" {
+		err = w.WriteField("password", password)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, named := range c.StringSlice("images") {
+		kv := strings.SplitN(named, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("bad image %s, want name=path", named)
+		}
+		err = addFormFile(w, kv[0], kv[1])
+		if err != nil {
+			return err
+		}
+	}
+	if placements := c.String("placements"); placements != "" {
+		err = w.WriteField("placements", placements)
+		if err != nil {
+			return err
+		}
 	}
 
 	page := c.String("page")
@@ -319,6 +800,14 @@ func imgaddpdf(c *cli.Context) error {
 		return err
 	}
 
+	store := c.Bool("store")
+	if store {
+		err = w.WriteField("output", "store")
+		if err != nil {
+			return err
+		}
+	}
+
 	w.Close()
 
 	req, err := http.NewRequest("POST", murl, &b)
@@ -333,6 +822,10 @@ func imgaddpdf(c *cli.Context) error {
 	// Don't forget to set the content type, this will contain the boundary.
 	req.Header.Set("Content-Type", w.FormDataContentType())
 	req.Header.Set("charset", "UTF-8")
+	if !store {
+		// get the pdf itself instead of base64 json
+		req.Header.Set("Accept", "application/pdf")
+	}
 	//req.Header.Set("token", token)
 
 	// Submit the request
@@ -341,6 +834,20 @@ func imgaddpdf(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && resp.Header.Get("Content-Type") == "application/pdf" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			return err
+		}
+		fmt.Println("success")
+		return nil
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -348,21 +855,521 @@ func imgaddpdf(c *cli.Context) error {
 	}
 
 	//fmt.Println(string(body))
-	if gjson.Get(string(body), "file").Exists() {
-		files := gjson.Get(string(body), "file").String()
-		fileb, err := base64.StdEncoding.DecodeString(files)
-		if err != nil {
-			return err
+	if gjson.Get(string(body), "resultfile").Exists() {
+		fmt.Println("success", gjson.Get(string(body), "resultfile").String())
+		return nil
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+		return nil
+	}
+
+}
+
+func merge(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/merge"
+
+	var parts []map[string]string
+	for _, f := range c.StringSlice("file") {
+		part := map[string]string{"file": f}
+		if i := strings.LastIndex(f, ":"); i >= 0 {
+			part["file"], part["page"] = f[:i], f[i+1:]
 		}
-		err = ioutil.WriteFile(file, fileb, 0666)
-		if err != nil {
-			return err
+		parts = append(parts, part)
+	}
+	files, err := json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"files": {string(files)}}
+
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "resultfile").Exists() {
+		fmt.Println("success", gjson.Get(string(body), "resultfile").String())
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func split(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/split"
+
+	form := url.Values{
+		"pdf":   {c.String("pdf")},
+		"mode":  {c.String("mode")},
+		"pages": {c.String("pages")},
+		"n":     {strconv.Itoa(c.Int("n"))},
+	}
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "resultfiles").Exists() {
+		for _, part := range gjson.Get(string(body), "resultfiles").Array() {
+			fmt.Println("success", part.Get("file").String(), part.Get("title").String())
 		}
-		fmt.Println("success")
-		return nil
 	} else {
-		fmt.Println("failed")
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func editpages(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/editpages"
+
+	form := url.Values{
+		"pdf":   {c.String("pdf")},
+		"edits": {c.String("edits")},
+	}
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "resultfile").Exists() {
+		fmt.Println("success", gjson.Get(string(body), "resultfile").String())
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func imagestopdf(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/imagestopdf"
+
+	images, err := json.Marshal(c.StringSlice("image"))
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"images":      {string(images)},
+		"size":        {c.String("size")},
+		"orientation": {c.String("orientation")},
+		"margin":      {c.String("margin")},
+	}
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "resultfile").Exists() {
+		fmt.Println("success", gjson.Get(string(body), "resultfile").String())
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func timestamp(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	file := c.String("file")
+	murl = murl + "/files/timestamp/" + file
+
+	req, err := http.NewRequest("GET", murl, nil)
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if !gjson.Get(string(body), "token").Exists() {
+		fmt.Println(string(body))
 		return nil
 	}
+	token, err := base64.StdEncoding.DecodeString(gjson.Get(string(body), "token").String())
+	if err != nil {
+		return err
+	}
+	fpath := filepath.Join(c.String("sdir"), file+".tsr")
+	err = ioutil.WriteFile(fpath, token, 0666)
+	if err != nil {
+		return err
+	}
+	fmt.Println("gentime:", gjson.Get(string(body), "gentime").String())
+	fmt.Println("success")
+	return nil
+}
+
+func fillform(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/fillform"
+
+	form := url.Values{
+		"pdf":     {c.String("pdf")},
+		"fields":  {c.String("fields")},
+		"flatten": {strconv.FormatBool(c.Bool("flatten"))},
+		"font":    {c.String("font")},
+	}
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "resultfile").Exists() {
+		fmt.Println("success", gjson.Get(string(body), "resultfile").String())
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func encrypt(c *cli.Context) error {
+	form := url.Values{
+		"pdf":         {c.String("pdf")},
+		"userpass":    {c.String("userpass")},
+		"ownerpass":   {c.String("ownerpass")},
+		"permissions": {c.String("permissions")},
+		"password":    {c.String("password")},
+	}
+	return postPdfForm(c, "/files/encrypt", form)
+}
+
+func decrypt(c *cli.Context) error {
+	form := url.Values{
+		"pdf":      {c.String("pdf")},
+		"password": {c.String("password")},
+	}
+	return postPdfForm(c, "/files/decrypt", form)
+}
+
+func sealregister(c *cli.Context) error {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	if err := addFormFile(w, "image", c.String("image")); err != nil {
+		return err
+	}
+	for _, name := range []string{"name", "width", "opacity"} {
+		if v := c.String(name); v != "" {
+			if err := w.WriteField(name, v); err != nil {
+				return err
+			}
+		}
+	}
+	w.Close()
+
+	req, err := http.NewRequest("POST", c.GlobalString("surl")+"/files/seal", &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	body, err := doRequest(c, req)
+	if err != nil {
+		return err
+	}
+	if gjson.Get(body, "seal").Exists() {
+		fmt.Println("success", gjson.Get(body, "seal").String())
+	} else {
+		fmt.Println("failed", gjson.Get(body, "message").String())
+	}
+	return nil
+}
+
+func seals(c *cli.Context) error {
+	req, err := http.NewRequest("GET", c.GlobalString("surl")+"/files/seals", nil)
+	if err != nil {
+		return err
+	}
+	body, err := doRequest(c, req)
+	if err != nil {
+		return err
+	}
+	if gjson.Get(body, "seals").Exists() {
+		for _, seal := range gjson.Get(body, "seals").Array() {
+			fmt.Println(seal.String())
+		}
+	} else {
+		fmt.Println("failed", gjson.Get(body, "message").String())
+	}
+	return nil
+}
+
+func sealdisable(c *cli.Context) error {
+	form := url.Values{"disabled": {strconv.FormatBool(!c.Bool("enable"))}}
+	murl := c.GlobalString("surl") + "/files/seal/disable/" + url.PathEscape(c.String("name"))
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := doRequest(c, req)
+	if err != nil {
+		return err
+	}
+	if gjson.Get(body, "status").String() == "ok" {
+		fmt.Println("success", gjson.Get(body, "seal").String(), "disabled", gjson.Get(body, "disabled").Bool())
+	} else {
+		fmt.Println("failed", gjson.Get(body, "message").String())
+	}
+	return nil
+}
+
+// doRequest sends the request with the head flag and returns the response
+// body.
+func doRequest(c *cli.Context, req *http.Request) (string, error) {
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func watermark(c *cli.Context) error {
+	form := url.Values{"pdf": {c.String("pdf")}}
+	for _, name := range []string{"text", "image", "font", "fontsize", "color", "width", "opacity", "angle", "spacing", "page"} {
+		if v := c.String(name); v != "" {
+			form.Set(name, v)
+		}
+	}
+	if c.Bool("tile") {
+		form.Set("tile", "true")
+	}
+	return postPdfForm(c, "/files/watermark", form)
+}
+
+func stamp(c *cli.Context) error {
+	form := url.Values{"pdf": {c.String("pdf")}}
+	for _, name := range []string{"image", "seal", "page", "xpos", "ypos", "width", "placements", "password"} {
+		if v := c.String(name); v != "" {
+			form.Set(name, v)
+		}
+	}
+	if c.Bool("audit") {
+		form.Set("audit", "true")
+		form.Set("auditfont", c.String("auditfont"))
+	}
+	return postPdfForm(c, "/files/imgaddpdf", form)
+}
+
+// postPdfForm posts the form to a pdf operation printing the stored result.
+func postPdfForm(c *cli.Context, path string, form url.Values) error {
+	murl := c.GlobalString("surl")
+	murl = murl + path
+
+	req, err := http.NewRequest("POST", murl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "resultfile").Exists() {
+		fmt.Println("success", gjson.Get(string(body), "resultfile").String())
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
 
+func audit(c *cli.Context) error {
+	query := url.Values{}
+	for _, name := range []string{"file", "id", "since", "until"} {
+		if v := c.String(name); v != "" {
+			query.Set(name, v)
+		}
+	}
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/audit?" + query.Encode()
+
+	req, err := http.NewRequest("GET", murl, nil)
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "records").Exists() {
+		for _, record := range gjson.Get(string(body), "records").Array() {
+			fmt.Println(record.String())
+		}
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func inspect(c *cli.Context) error {
+	murl := c.GlobalString("surl")
+	murl = murl + "/files/inspect/" + c.String("file")
+
+	req, err := http.NewRequest("GET", murl, nil)
+	if err != nil {
+		return err
+	}
+	k, v := head(c)
+	if !strings.EqualFold(k, "") {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("charset", "UTF-8")
+
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if gjson.Get(string(body), "inspect").Exists() {
+		fmt.Println(gjson.Get(string(body), "inspect").String())
+	} else {
+		fmt.Println("failed", gjson.Get(string(body), "message").String())
+	}
+	return nil
+}
+
+func addFormFile(w *multipart.Writer, field string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw, err := w.CreateFormFile(field, path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
 }
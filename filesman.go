@@ -3,27 +3,47 @@ package filesman
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/minio/sha256-simd"
 	"github.com/shellow/keyman"
 	"github.com/tjfoc/gmsm/sm3"
+	smx509 "github.com/tjfoc/gmsm/x509"
 	"github.com/unidoc/unipdf/creator"
-	pdf "github.com/unidoc/unipdf/model"
 	"io/ioutil"
 	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const FILEKEY = "uploadfile"
 
+const PDF_TYPE = "application/pdf"
+
+const (
+	OUTPUT_JSON  = "json"  // base64 in a json body
+	OUTPUT_PDF   = "pdf"   // the pdf as response body
+	OUTPUT_STORE = "store" // stored for the caller, its name returned
+)
+
 type Filesman struct {
 	Filedir       string
 	MaxUploadSize int64
+	TsaURL        string   // RFC 3161 TSA, empty disables timestamping
+	Cipher        string   // CIPHER_SM4 or CIPHER_AES encrypts files at rest
+	MasterKey     []byte   // wraps the per-file data keys
+	CompressTypes []string // content types stored gzip compressed
+	Retention     []RetentionPolicy
+	FontDir       string           // TrueType fonts for text stamps
+	Signer        *Signer          // PAdES signing key, nil disables signing
+	TrustRoots    *smx509.CertPool // signatures are verified up to these
+	VerifyURL     string           // QR stamp payload, may use the stampText variables
+	AdminToken    string           // lifts legal holds, empty allows no one
 }
 
 func NewFilesman() *Filesman {
@@ -37,6 +57,19 @@ func BuildFilename(addr string, filename string) string {
 	return addr + "-" + filename
 }
 
+// errFilename rejects names that are not a plain file name, so they can
+// not reach files of other addresses or outside Filedir.
+var errFilename = errors.New("Invalid filename")
+
+// validFilename reports whether a client supplied name is a plain file
+// name.
+func validFilename(filename string) bool {
+	return filename != "" && filepath.Base(filename) == filename &&
+		!strings.Contains(filename, "..") && !strings.ContainsAny(filename, `/\`)
+}
+
+// GenFilename returns the stored name of a file of the caller. On an
+// invalid token or file name the response has been sent.
 func GenFilename(c *gin.Context, filename string) (string, error) {
 	addr, err := keyman.TokenToAddrStr(c.GetHeader("token"))
 	if err != nil {
@@ -46,10 +79,43 @@ func GenFilename(c *gin.Context, filename string) (string, error) {
 		})
 		return "", err
 	}
+	if !validFilename(filename) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": errFilename.Error(),
+		})
+		return "", errFilename
+	}
 	filename = BuildFilename(addr, filename)
 	return filename, nil
 }
 
+// paramFloat parses a float parameter, def when it is empty.
+func paramFloat(value string, def float64) (float64, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// formFile reads a multipart file field, rejecting files over MaxUploadSize.
+func (filesman *Filesman) formFile(c *gin.Context, field string) ([]byte, error) {
+	file, fileHeader, err := c.Request.FormFile(field)
+	if err != nil {
+		return nil, errors.New("Invalid file")
+	}
+	defer file.Close()
+	// validate file size
+	if fileHeader.Size > filesman.MaxUploadSize {
+		return nil, errors.New("File too big")
+	}
+	fileBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, errors.New("Invalid file")
+	}
+	return fileBytes, nil
+}
+
 func (filesman *Filesman) Upload(c *gin.Context) (filename string) {
 	c.Header("Access-Control-Allow-Origin", "*")
 	if err := c.Request.ParseMultipartForm(filesman.MaxUploadSize); err != nil {
@@ -80,6 +146,17 @@ func (filesman *Filesman) Upload(c *gin.Context) (filename string) {
 		})
 		return
 	}
+	var ttl time.Duration
+	if ttlStr := c.Request.FormValue("ttl"); ttlStr != "" {
+		ttl, err = time.ParseDuration(ttlStr)
+		if err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Params ttl error",
+			})
+			return
+		}
+	}
 	fileBytes, err := ioutil.ReadAll(file)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -91,9 +168,13 @@ func (filesman *Filesman) Upload(c *gin.Context) (filename string) {
 
 	// check file type, detectcontenttype only needs the first 512 bytes
 	detectedFileType := http.DetectContentType(fileBytes)
+	if IsE2E(fileBytes) {
+		detectedFileType = E2E_TYPE
+	}
 	switch detectedFileType {
 	case "image/jpeg", "image/jpg":
 	case "image/gif", "image/png":
+	case E2E_TYPE:
 	case "application/pdf":
 		break
 	default:
@@ -119,11 +200,8 @@ func (filesman *Filesman) Upload(c *gin.Context) (filename string) {
 		return
 	}
 
-	newPath := filepath.Join(filesman.Filedir, filenameReal)
-	//fmt.Printf("FileType: %s, File: %s\n", detectedFileType, newPath)
-
 	// write file
-	newFile, err := os.Create(newPath)
+	meta, err := filesman.StoreFile(filenameReal, fileBytes, detectedFileType, ttl)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
@@ -131,18 +209,25 @@ func (filesman *Filesman) Upload(c *gin.Context) (filename string) {
 		})
 		return
 	}
-	defer newFile.Close() // idempotent, okay to call twice
-	if _, err := newFile.Write(fileBytes); err != nil || newFile.Close() != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Can not write file",
-		})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{
+
+	result := gin.H{
 		"status": "ok",
 		"file":   filename,
-	})
+	}
+	if expires, ok := filesman.ExpireTime(filenameReal, meta); ok {
+		result["expires"] = expires
+	}
+	if meta.Pages > 0 {
+		result["pages"] = meta.Pages
+	}
+	if filesman.TsaURL != "" {
+		if err := filesman.StoreTimestamp(filenameReal, fileBytes); err != nil {
+			result["timestamp"] = err.Error()
+		} else {
+			result["timestamp"] = "ok"
+		}
+	}
+	c.JSON(http.StatusOK, result)
 	return filename
 }
 
@@ -155,9 +240,37 @@ func (filesman *Filesman) Download(c *gin.Context) {
 		return
 	}
 
-	filepath := filepath.Join(filesman.Filedir, filename)
+	fileBytes, encoding, err := filesman.ReadFileEncoded(filename)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "File not found",
+		})
+		return
+	}
+	if encoding == ENCODING_GZIP {
+		c.Header("Vary", "Accept-Encoding")
+		if AcceptsEncoding(c.GetHeader("Accept-Encoding"), encoding) {
+			c.Header("status", "ok")
+			c.Header("Content-Encoding", encoding)
+			c.Data(http.StatusOK, mime.TypeByExtension(filepath.Ext(filename)), fileBytes)
+			return
+		}
+		fileBytes, err = Decompress(fileBytes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Can not read file",
+			})
+			return
+		}
+	}
+	var modtime time.Time
+	if info, err := filesman.Stat(filename); err == nil {
+		modtime = info.ModTime()
+	}
 	c.Header("status", "ok")
-	c.File(filepath)
+	http.ServeContent(c.Writer, c.Request, filename, modtime, bytes.NewReader(fileBytes))
 }
 
 func (filesman *Filesman) Hash(c *gin.Context) {
@@ -168,19 +281,7 @@ func (filesman *Filesman) Hash(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	filepath := filepath.Join(filesman.Filedir, filename)
-
-	file, err := os.OpenFile(filepath, os.O_RDONLY, 0644)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Can not write file",
-		})
-		return
-	}
-	defer file.Close()
-
-	fileBytes, err := ioutil.ReadAll(file)
+	fileBytes, err := filesman.ReadFile(filename)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
@@ -205,56 +306,46 @@ func (filesman *Filesman) Hash(c *gin.Context) {
 	return
 }
 
+// AddImageToPdf places the image on page pageNum, -1 for all pages.
 func AddImageToPdf(inputPath string, outputPath string, imagePath string, pageNum int, xPos float64, yPos float64, iwidth float64) error {
-
-	c := creator.New()
-
-	// Prepare the image.
-	img, err := c.NewImageFromFile(imagePath)
+	pages, err := PageNumSelector(pageNum)
 	if err != nil {
 		return err
 	}
-	img.ScaleToWidth(iwidth)
-	img.SetPos(xPos, yPos)
+	return AddImageToPdfPages(inputPath, outputPath, imagePath, pages, xPos, yPos, iwidth)
+}
 
-	// Read the input pdf file.
-	f, err := os.Open(inputPath)
+// AddImageToPdfPages places the image on the selected pages.
+func AddImageToPdfPages(inputPath string, outputPath string, imagePath string, pages PageSelector, xPos float64, yPos float64, iwidth float64) error {
+	pdfData, err := ioutil.ReadFile(inputPath)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	pdfReader, err := pdf.NewPdfReader(f)
+	imgData, err := ioutil.ReadFile(imagePath)
 	if err != nil {
 		return err
 	}
-
-	numPages, err := pdfReader.GetNumPages()
+	out, err := AddImageToPdfDataPages(pdfData, imgData, pages, xPos, yPos, iwidth)
 	if err != nil {
 		return err
 	}
+	return ioutil.WriteFile(outputPath, out, 0644)
+}
 
-	// Load the pages.
-	for i := 0; i < numPages; i++ {
-		page, err := pdfReader.GetPage(i + 1)
-		if err != nil {
-			return err
-		}
-
-		// Add the page.
-		err = c.AddPage(page)
-		if err != nil {
-			return err
-		}
-
-		// If the specified page, or -1, apply the image to the page.
-		if i+1 == pageNum || pageNum == -1 {
-			_ = c.Draw(img)
-		}
+// AddImageToPdfData is AddImageToPdf working on file contents, so it can be
+// used on files kept encrypted in storage.
+func AddImageToPdfData(pdfData []byte, imgData []byte, pageNum int, xPos float64, yPos float64, iwidth float64) ([]byte, error) {
+	pages, err := PageNumSelector(pageNum)
+	if err != nil {
+		return nil, err
 	}
+	return AddImageToPdfDataPages(pdfData, imgData, pages, xPos, yPos, iwidth)
+}
 
-	err = c.WriteToFile(outputPath)
-	return err
+// AddImageToPdfDataPages is AddImageToPdfPages working on file contents.
+func AddImageToPdfDataPages(pdfData []byte, imgData []byte, pages PageSelector, xPos float64, yPos float64, iwidth float64) ([]byte, error) {
+	placement := Placement{Image: "image", Page: pages, Xpos: xPos, Ypos: yPos, Width: iwidth}
+	return StampPdf(pdfData, []Placement{placement}, map[string][]byte{"image": imgData}, StampOptions{})
 }
 
 func (filesman *Filesman) ImgAddPdf(c *gin.Context) {
@@ -273,103 +364,125 @@ func (filesman *Filesman) ImgAddPdf(c *gin.Context) {
 		return
 	}
 
-	pdfpath := filepath.Join(filesman.Filedir, pdffile)
-
-	pagestr, ok := c.GetPostForm("page")
-	if !ok {
+	placements, err := ParsePlacements(c.PostForm, c.PostForm("image"))
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "error",
-			"message": "Params page error",
+			"message": err.Error(),
 		})
 		return
 	}
-
-	page, err := strconv.Atoi(pagestr)
+	// audit appends a signing certificate page and records the stamping
+	audit, err := strconv.ParseBool(c.DefaultPostForm("audit", "false"))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "error",
-			"message": "Params page error",
+			"message": "Params audit error",
 		})
 		return
 	}
 
-	image, ok := c.GetPostForm("image")
-	if !ok {
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "error",
-			"message": "Params image error",
+			"message": "Can not read pdf",
 		})
 		return
 	}
-	image, err = GenFilename(c, image)
-	if err != nil {
-		return
+	images := make(map[string][]byte)
+	for _, ref := range ImageRefs(placements) {
+		image, err := GenFilename(c, ref)
+		if err != nil {
+			return
+		}
+		imgData, err := filesman.ReadFile(image)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Can not read image",
+			})
+			return
+		}
+		images[ref] = imgData
 	}
-	imagepath := filepath.Join(filesman.Filedir, image)
 
-	xposStr, ok := c.GetPostForm("xpos")
-	if !ok {
+	addr, _ := SplitFilename(pdffile)
+	if err := filesman.resolveSeals(addr, placements, images); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "error",
-			"message": "Params xpos error",
+			"message": stampErrorMessage(err, "Can not read seal"),
 		})
 		return
 	}
-	xpos, err := strconv.ParseFloat(xposStr, 64)
+	opts := StampOptions{Addr: addr, FontDir: filesman.FontDir, Password: c.PostForm("password"), VerifyURL: filesman.VerifyURL}
+	if meta, err := filesman.ReadMeta(pdffile); err == nil {
+		opts.Time = meta.Created
+	} else if info, err := filesman.Stat(pdffile); err == nil {
+		opts.Time = info.ModTime()
+	}
+
+	out, err := StampPdf(pdfData, placements, images, opts)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "error",
-			"message": "Params xpos error",
+			"message": stampErrorMessage(err, "Merge error"),
 		})
 		return
 	}
+	var record *AuditRecord
+	if audit {
+		_, source := SplitFilename(pdffile)
+		record, err = NewAuditRecord(addr, source, opts.Time, pdfData, placements, PdfPageCount(out))
+		if err == nil {
+			out, err = AppendAuditPage(out, record, filesman.FontDir, c.PostForm("auditfont"))
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Audit page error",
+			})
+			return
+		}
+	}
 
-	yposStr, ok := c.GetPostForm("ypos")
-	if !ok {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "error",
-			"message": "Params ypos error",
-		})
-		return
+	placementsJson, _ := json.Marshal(placements)
+	if record != nil {
+		// every audited stamping has its own result, the audit page showing
+		// the record
+		placementsJson = append(placementsJson, record.ID...)
 	}
-	ypos, err := strconv.ParseFloat(yposStr, 64)
+	hash := sha256.Sum256(append([]byte(pdffile), placementsJson...))
+	outfile := fmt.Sprintf("%x", hash) + ".pdf"
+	outfileReal, err := GenFilename(c, outfile)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "error",
-			"message": "Params ypos error",
-		})
 		return
 	}
-
-	widthStr, ok := c.GetPostForm("width")
-	if !ok {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "error",
-			"message": "Params width error",
-		})
-		return
+	if record != nil {
+		record.Result = outfile
+		record.ResultSha256, record.ResultSm3 = sourceHashes(out)
 	}
-	width, err := strconv.ParseFloat(widthStr, 64)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
+	if _, err := filesman.StoreFile(outfileReal, out, PDF_TYPE, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Params width error",
+			"message": "Can not write file",
 		})
 		return
 	}
-	hash := sha256.Sum256([]byte(pdffile + image))
-	outfile := fmt.Sprintf("%x", hash) + ".pdf"
-	outfileReal, err := GenFilename(c, outfile)
-	if err != nil {
-		return
-	}
-	outfilepath := filepath.Join(filesman.Filedir, outfileReal)
-
-	err = AddImageToPdf(pdfpath, outfilepath, imagepath, page, xpos, ypos, width)
-	if err != nil {
+	if record != nil {
+		if err := filesman.AddAuditRecord(addr, record); err != nil {
+			// no audited result without its record
+			filesman.Remove(outfileReal)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Can not write audit trail",
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"status":  "error",
-			"message": "Merge error",
+			"status":     "ok",
+			"resultfile": outfile,
+			"audit":      record.ID,
 		})
 		return
 	}
@@ -390,71 +503,30 @@ func (filesman *Filesman) ImgAddPdfOnce(c *gin.Context) {
 		return
 	}
 
-	xposStr := c.Request.FormValue("xpos")
-	xpos, err := strconv.ParseFloat(xposStr, 64)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "error",
-			"message": "Params xpos error",
-		})
-		return
-	}
-
-	yposStr := c.Request.FormValue("ypos")
-	ypos, err := strconv.ParseFloat(yposStr, 64)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "error",
-			"message": "Params ypos error",
-		})
-		return
-	}
-
-	widthStr := c.Request.FormValue("width")
-	width, err := strconv.ParseFloat(widthStr, 64)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
+	mode := outputMode(c)
+	if mode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": "Params width error",
+			"message": "Params output error",
 		})
 		return
 	}
 
-	pagestr := c.Request.FormValue("page")
-	pageNum, err := strconv.Atoi(pagestr)
+	placements, err := ParsePlacements(c.Request.FormValue, "image")
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "error",
-			"message": "Params page error",
+			"message": err.Error(),
 		})
 		return
 	}
 
 	// parse and validate file and post parameters
-	pdffile, fileHeader, err := c.Request.FormFile("pdf")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid file",
-		})
-		return
-	}
-	defer pdffile.Close()
-	// Get and print out file size
-	fileSize := fileHeader.Size
-	// validate file size
-	if fileSize > filesman.MaxUploadSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "File too big",
-		})
-		return
-	}
-	pdffileBytes, err := ioutil.ReadAll(pdffile)
+	pdffileBytes, err := filesman.formFile(c, "pdf")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": "Invalid file",
+			"message": err.Error(),
 		})
 		return
 	}
@@ -472,123 +544,136 @@ func (filesman *Filesman) ImgAddPdfOnce(c *gin.Context) {
 		return
 	}
 
-	// parse and validate file and post parameters
-	imgfile, fileHeader, err := c.Request.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid file",
-		})
-		return
+	// every image placement names the form file field holding its image
+	images := make(map[string][]byte)
+	for _, ref := range ImageRefs(placements) {
+		imgfileBytes, err := filesman.formFile(c, ref)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		detectedFileType = http.DetectContentType(imgfileBytes)
+		switch detectedFileType {
+		case "image/jpeg", "image/jpg":
+		case "image/gif", "image/png":
+			break
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid file type",
+			})
+			return
+		}
+		images[ref] = imgfileBytes
 	}
-	defer pdffile.Close()
-	// Get and print out file size
-	fileSize = fileHeader.Size
-	// validate file size
-	if fileSize > filesman.MaxUploadSize {
+
+	// the token is optional here, {addr} stays empty without it
+	addr, _ := keyman.TokenToAddrStr(c.GetHeader("token"))
+	if err := filesman.resolveSeals(addr, placements, images); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": "File too big",
+			"message": stampErrorMessage(err, "Can not read seal"),
 		})
 		return
 	}
-	imgfileBytes, err := ioutil.ReadAll(imgfile)
+	opts := StampOptions{Addr: addr, Time: time.Now(), FontDir: filesman.FontDir, Password: c.Request.FormValue("password"), VerifyURL: filesman.VerifyURL}
+	pdfCreator, err := StampCreator(pdffileBytes, placements, images, opts)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
-			"message": "Invalid file",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// check file type, detectcontenttype only needs the first 512 bytes
-	detectedFileType = http.DetectContentType(imgfileBytes)
-	switch detectedFileType {
-	case "image/jpeg", "image/jpg":
-	case "image/gif", "image/png":
-		break
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid file type",
-		})
-		return
-	}
-
-	content := creator.New()
+	filesman.sendCreator(c, mode, pdfCreator)
+}
 
-	// Prepare the image.
-	img, err := content.NewImageFromData(imgfileBytes)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": err,
-		})
-		return
+// outputMode returns how a produced pdf is sent back, as the output
+// parameter says or else as the Accept header prefers. It is empty for an
+// invalid output parameter.
+func outputMode(c *gin.Context) string {
+	switch output := c.Request.FormValue("output"); output {
+	case OUTPUT_JSON, OUTPUT_PDF, OUTPUT_STORE:
+		return output
+	case "":
+		if c.NegotiateFormat(gin.MIMEJSON, PDF_TYPE) == PDF_TYPE {
+			return OUTPUT_PDF
+		}
+		return OUTPUT_JSON
 	}
-	img.ScaleToWidth(width)
-	img.SetPos(xpos, ypos)
+	return ""
+}
 
-	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdffileBytes))
+// storePdf stores a produced pdf for the caller, named by its hash, and
+// returns the name. On error the response has been sent.
+func (filesman *Filesman) storePdf(c *gin.Context, out []byte) (string, error) {
+	hash := sha256.Sum256(out)
+	outfile := fmt.Sprintf("%x", hash) + ".pdf"
+	outfileReal, err := GenFilename(c, outfile)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": err,
-		})
-		return
+		return "", err
 	}
-
-	numPages, err := pdfReader.GetNumPages()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+	if _, err := filesman.StoreFile(outfileReal, out, PDF_TYPE, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": err,
+			"message": "Can not write file",
 		})
-		return
+		return "", err
 	}
+	return outfile, nil
+}
 
-	// Load the pages.
-	for i := 0; i < numPages; i++ {
-		page, err := pdfReader.GetPage(i + 1)
+// sendPdf sends a produced pdf back in the output mode, see storePdf for
+// OUTPUT_STORE.
+func (filesman *Filesman) sendPdf(c *gin.Context, mode string, out []byte) {
+	switch mode {
+	case OUTPUT_PDF:
+		c.Header("Content-Disposition", `attachment; filename="result.pdf"`)
+		c.Data(http.StatusOK, PDF_TYPE, out)
+	case OUTPUT_STORE:
+		outfile, err := filesman.storePdf(c, out)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  "error",
-				"message": err,
-			})
-			return
-		}
-
-		// Add the page.
-		err = content.AddPage(page)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  "error",
-				"message": err,
-			})
 			return
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":     "ok",
+			"resultfile": outfile,
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+			"file":   base64.StdEncoding.EncodeToString(out),
+		})
+	}
+}
 
-		// If the specified page, or -1, apply the image to the page.
-		if i+1 == pageNum || pageNum == -1 {
-			_ = content.Draw(img)
+// sendCreator sends the pdf of a creator back in the output mode, writing it
+// straight to the response for OUTPUT_PDF.
+func (filesman *Filesman) sendCreator(c *gin.Context, mode string, pdfCreator *creator.Creator) {
+	if mode == OUTPUT_PDF {
+		c.Header("Content-Disposition", `attachment; filename="result.pdf"`)
+		c.Header("Content-Type", PDF_TYPE)
+		c.Status(http.StatusOK)
+		if err := pdfCreator.Write(c.Writer); err != nil {
+			// the response has begun, a truncated pdf is all the client gets
+			c.Error(err)
 		}
+		return
 	}
-
 	buffer := bytes.NewBuffer([]byte{})
-	err = content.Write(buffer)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+	if err := pdfCreator.Write(buffer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": err,
+			"message": "Can not write pdf",
 		})
 		return
 	}
-
-	encoded := base64.StdEncoding.EncodeToString(buffer.Bytes())
-	c.JSON(http.StatusBadRequest, gin.H{
-		"status": "ok",
-		"file":   encoded,
-	})
+	filesman.sendPdf(c, mode, buffer.Bytes())
 }
 
 func Listfile(prefix string) []string {
@@ -5,13 +5,28 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/shellow/filesman"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 var Logger *zap.SugaredLogger
 var LISTENADDR string
+var TSAURL string
+var CIPHER string
+var MASTERKEY string
+var COMPRESS string
+var RETENTION string
+var REAPINTERVAL time.Duration
+var FONTDIR string
+var VERIFYURL string
+var SIGNCERT string
+var SIGNKEY string
+var SIGNPASS string
+var TRUSTROOTS string
+var ADMINTOKEN string
 var Filesm *filesman.Filesman
 
 func main() {
@@ -21,6 +36,19 @@ func main() {
 
 func initarg() {
 	flag.StringVar(&LISTENADDR, "addr", ":8080", "listen address")
+	flag.StringVar(&TSAURL, "tsa", "", "RFC 3161 timestamp authority url")
+	flag.StringVar(&CIPHER, "cipher", "", "encrypt files at rest: sm4 or aes")
+	flag.StringVar(&MASTERKEY, "masterkey", "", "hex master key, or @file to read it from file")
+	flag.StringVar(&COMPRESS, "compress", "", "content types stored gzip compressed, comma separated, e.g. application/pdf,image/gif")
+	flag.StringVar(&RETENTION, "retention", "", "retention policies json file")
+	flag.DurationVar(&REAPINTERVAL, "reap", 10*time.Minute, "interval to remove expired files, 0 to not remove them")
+	flag.StringVar(&FONTDIR, "fontdir", "", "dir of TrueType fonts for text stamps")
+	flag.StringVar(&VERIFYURL, "verifyurl", "", "QR stamp payload, e.g. https://example.com/verify?sm3={sm3}&addr={addr}")
+	flag.StringVar(&SIGNCERT, "signcert", "", "PKCS#12 file of the RSA signing key, or SM2 certificate pem with -signkey")
+	flag.StringVar(&SIGNKEY, "signkey", "", "SM2 signing key pem")
+	flag.StringVar(&SIGNPASS, "signpass", "", "password of the PKCS#12 file or SM2 key")
+	flag.StringVar(&TRUSTROOTS, "trustroots", "", "pem file of the CA certificates signatures are verified against")
+	flag.StringVar(&ADMINTOKEN, "admintoken", "", "token lifting legal holds, or @file to read it from file")
 	flag.Parse()
 }
 
@@ -33,6 +61,71 @@ func initApp() {
 	Logger = logger.Sugar()
 
 	Filesm = filesman.NewFilesman()
+	Filesm.TsaURL = TSAURL
+	Filesm.FontDir = FONTDIR
+	Filesm.VerifyURL = VERIFYURL
+	if strings.HasPrefix(ADMINTOKEN, "@") {
+		b, err := ioutil.ReadFile(ADMINTOKEN[1:])
+		if err != nil {
+			Logger.Error(err)
+			os.Exit(-1)
+		}
+		ADMINTOKEN = strings.TrimSpace(string(b))
+	}
+	Filesm.AdminToken = ADMINTOKEN
+	if CIPHER != "" {
+		masterkey, err := filesman.LoadMasterKey(MASTERKEY)
+		if err == nil {
+			// check cipher name and key size early
+			_, err = filesman.EncryptData(CIPHER, masterkey, nil)
+		}
+		if err != nil {
+			Logger.Error(err)
+			os.Exit(-1)
+		}
+		Filesm.Cipher = CIPHER
+		Filesm.MasterKey = masterkey
+	}
+	if COMPRESS != "" {
+		Filesm.CompressTypes = strings.Split(COMPRESS, ",")
+	}
+	if RETENTION != "" {
+		policies, err := filesman.LoadRetention(RETENTION)
+		if err != nil {
+			Logger.Error(err)
+			os.Exit(-1)
+		}
+		Filesm.Retention = policies
+	}
+	if SIGNCERT != "" {
+		var signer *filesman.Signer
+		var err error
+		if SIGNKEY != "" {
+			signer, err = filesman.LoadSM2Signer(SIGNCERT, SIGNKEY, SIGNPASS)
+		} else {
+			signer, err = filesman.LoadPKCS12Signer(SIGNCERT, SIGNPASS)
+		}
+		if err != nil {
+			Logger.Error(err)
+			os.Exit(-1)
+		}
+		Filesm.Signer = signer
+	}
+	if TRUSTROOTS != "" {
+		roots, err := filesman.LoadTrustRoots(TRUSTROOTS)
+		if err != nil {
+			Logger.Error(err)
+			os.Exit(-1)
+		}
+		Filesm.TrustRoots = roots
+	}
+	if REAPINTERVAL < 0 {
+		Logger.Error("negative reap interval ", REAPINTERVAL)
+		os.Exit(-1)
+	}
+	if REAPINTERVAL > 0 {
+		go reaper()
+	}
 
 	Logger.Info("init finish")
 }
@@ -47,6 +140,25 @@ func server() {
 	router.POST("/files/upload", upload)
 	router.GET("/files/download/:filename", Filesm.Download)
 	router.POST("/files/imgsignpdf", Filesm.ImgAddPdfOnce)
+	router.POST("/files/imgaddpdf", Filesm.ImgAddPdf)
+	router.POST("/files/watermark", Filesm.Watermark)
+	router.POST("/files/sign", Filesm.Sign)
+	router.POST("/files/verify", Filesm.Verify)
+	router.POST("/files/merge", Filesm.Merge)
+	router.POST("/files/split", Filesm.Split)
+	router.POST("/files/editpages", Filesm.EditPages)
+	router.POST("/files/imagestopdf", Filesm.ImagesToPdf)
+	router.POST("/files/fillform", Filesm.FillForm)
+	router.POST("/files/encrypt", Filesm.Encrypt)
+	router.POST("/files/decrypt", Filesm.Decrypt)
+	router.POST("/files/seal", Filesm.RegisterSeal)
+	router.GET("/files/seals", Filesm.ListSeals)
+	router.POST("/files/seal/disable/:name", Filesm.DisableSeal)
+	router.GET("/files/audit", Filesm.Audit)
+	router.GET("/files/inspect/:filename", Filesm.Inspect)
+	router.GET("/files/timestamp/:filename", Filesm.Timestamp)
+	router.POST("/files/hold/:filename", Filesm.LegalHold)
+	router.DELETE("/files/delete/:filename", Filesm.Delete)
 
 	s := &http.Server{
 		Addr:           LISTENADDR,
@@ -67,3 +179,13 @@ func server() {
 func upload(c *gin.Context) {
 	Filesm.Upload(c)
 }
+
+func reaper() {
+	ticker := time.NewTicker(REAPINTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, f := range Filesm.Reap() {
+			Logger.Info("expired ", f)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package filesman
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/unidoc/unipdf/annotator"
+	"github.com/unidoc/unipdf/core"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+	"strconv"
+)
+
+const MAX_FORM_FIELDS = 1000
+
+var errNoForm = errors.New("No form fields")
+
+// FormFieldError reports a field not in the form or a value it can not
+// take.
+type FormFieldError struct {
+	Field  string
+	Reason string
+}
+
+func (err *FormFieldError) Error() string {
+	return fmt.Sprintf("Field %q: %s", err.Field, err.Reason)
+}
+
+// FillOptions says how FillForm fills in a form. Font is looked up as for
+// text stamps and draws the filled in text fields, for text the form fonts
+// lack glyphs of.
+type FillOptions struct {
+	Flatten bool
+	Font    string
+	FontDir string
+}
+
+// fieldValues provides the values of FillWithAppearance.
+type fieldValues map[string]core.PdfObject
+
+func (values fieldValues) FieldValues() (map[string]core.PdfObject, error) {
+	return values, nil
+}
+
+// fillAppearance generates the appearances of the filled in fields anew,
+// those of the others only when missing, as the kept appearance of a
+// choice or button field would show its old value.
+type fillAppearance struct {
+	annotator.FieldAppearance
+	filled map[*pdf.PdfField]bool
+}
+
+func (fa fillAppearance) GenerateAppearanceDict(form *pdf.PdfAcroForm, field *pdf.PdfField, wa *pdf.PdfAnnotationWidget) (*core.PdfObjectDictionary, error) {
+	appearance := fa.FieldAppearance
+	if fa.filled[field] {
+		appearance.OnlyIfMissing = false
+	}
+	return appearance.GenerateAppearanceDict(form, field, wa)
+}
+
+// buttonStates returns the on states of the widgets of a checkbox or radio
+// button field.
+func buttonStates(field *pdf.PdfField) []string {
+	var states []string
+	for _, widget := range field.Annotations {
+		if widget.PdfAnnotation == nil {
+			continue
+		}
+		ap, ok := core.GetDict(widget.AP)
+		if !ok {
+			continue
+		}
+		n, ok := core.GetDict(ap.Get("N"))
+		if !ok {
+			continue
+		}
+		for _, key := range n.Keys() {
+			if key != "Off" {
+				states = append(states, string(key))
+			}
+		}
+	}
+	return states
+}
+
+// fieldObject converts a json value for the field: a string or number for
+// text and choice fields, a list of strings for multiple choice, true or
+// false for checkboxes and the chosen state for radio buttons.
+func fieldObject(field *pdf.PdfField, value interface{}) (core.PdfObject, error) {
+	switch ctx := field.GetContext().(type) {
+	case *pdf.PdfFieldText:
+		switch v := value.(type) {
+		case string:
+			return core.MakeString(v), nil
+		case float64:
+			return core.MakeString(strconv.FormatFloat(v, 'f', -1, 64)), nil
+		}
+		return nil, fmt.Errorf("text needs a string")
+	case *pdf.PdfFieldChoice:
+		switch v := value.(type) {
+		case string:
+			return core.MakeString(v), nil
+		case []interface{}:
+			var items []core.PdfObject
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("choice needs strings")
+				}
+				items = append(items, core.MakeString(s))
+			}
+			return core.MakeArray(items...), nil
+		}
+		return nil, fmt.Errorf("choice needs a string or a list of strings")
+	case *pdf.PdfFieldButton:
+		states := buttonStates(field)
+		switch ctx.GetType() {
+		case pdf.ButtonTypeCheckbox:
+			checked, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("checkbox needs true or false")
+			}
+			if !checked {
+				return core.MakeName("Off"), nil
+			}
+			if len(states) > 0 {
+				return core.MakeName(states[0]), nil
+			}
+			return core.MakeName("Yes"), nil
+		case pdf.ButtonTypeRadio:
+			state, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("radio button needs a state")
+			}
+			if state == "Off" {
+				return core.MakeName(state), nil
+			}
+			for _, s := range states {
+				if s == state {
+					return core.MakeName(state), nil
+				}
+			}
+			return nil, fmt.Errorf("radio button has no state %q", state)
+		}
+		return nil, fmt.Errorf("push button takes no value")
+	}
+	return nil, fmt.Errorf("can not be filled in")
+}
+
+// FillForm fills in the form fields of the pdf, named by their full names,
+// and flattens them when asked to.
+func FillForm(pdfData []byte, values map[string]interface{}, opts FillOptions) ([]byte, error) {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	if pdfReader.AcroForm == nil {
+		return nil, errNoForm
+	}
+
+	fields := make(map[string]*pdf.PdfField)
+	for _, field := range pdfReader.AcroForm.AllFields() {
+		if name, err := field.FullName(); err == nil {
+			fields[name] = field
+		}
+	}
+	provider := make(fieldValues)
+	filled := make(map[*pdf.PdfField]bool)
+	for name, value := range values {
+		field, ok := fields[name]
+		if !ok {
+			return nil, &FormFieldError{Field: name, Reason: "not in the form"}
+		}
+		obj, err := fieldObject(field, value)
+		if err != nil {
+			return nil, &FormFieldError{Field: name, Reason: err.Error()}
+		}
+		provider[name] = obj
+		filled[field] = true
+	}
+
+	appearance := fillAppearance{
+		FieldAppearance: annotator.FieldAppearance{OnlyIfMissing: true, RegenerateTextFields: true},
+		filled:          filled,
+	}
+	if opts.Font != "" {
+		font, err := loadFont(opts.FontDir, opts.Font)
+		if err != nil {
+			return nil, err
+		}
+		style := appearance.Style()
+		style.Fonts = &annotator.AppearanceFontStyle{
+			Fallback: &annotator.AppearanceFont{Name: opts.Font, Font: font},
+		}
+		appearance.SetStyle(style)
+	}
+	if err := pdfReader.AcroForm.FillWithAppearance(provider, appearance); err != nil {
+		return nil, err
+	}
+	if opts.Flatten {
+		if err := pdfReader.FlattenFields(false, appearance); err != nil {
+			return nil, err
+		}
+	}
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	c := creator.New()
+	for i := 1; i <= numPages; i++ {
+		page, err := pdfReader.GetPage(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Flatten {
+		if err := c.SetForms(pdfReader.AcroForm); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// FillForm fills in a stored pdf form with the json object of field names
+// and values of the fields parameter, see fieldObject, and stores the
+// result for the caller. The flatten parameter makes the fields part of
+// the pages.
+func (filesman *Filesman) FillForm(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(c.PostForm("fields")), &values); err != nil || len(values) == 0 || len(values) > MAX_FORM_FIELDS {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params fields error",
+		})
+		return
+	}
+	flatten, err := strconv.ParseBool(c.DefaultPostForm("flatten", "false"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params flatten error",
+		})
+		return
+	}
+	pdffile, err = GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	opts := FillOptions{Flatten: flatten, Font: c.PostForm("font"), FontDir: filesman.FontDir}
+	out, err := FillForm(pdfData, values, opts)
+	if err != nil {
+		msg := "Fill error"
+		if _, ok := err.(*FormFieldError); ok || err == errNoForm {
+			msg = err.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": msg,
+		})
+		return
+	}
+	filesman.sendPdf(c, OUTPUT_STORE, out)
+}
@@ -0,0 +1,123 @@
+package filesman
+
+import (
+	"bytes"
+	"github.com/unidoc/unipdf/annotator"
+	"github.com/unidoc/unipdf/creator"
+	"github.com/unidoc/unipdf/extractor"
+	pdf "github.com/unidoc/unipdf/model"
+	"strings"
+	"testing"
+)
+
+// testFormPdf returns a one page pdf with the text field name and the
+// combo box fruit.
+func testFormPdf(t *testing.T) []byte {
+	c := creator.New()
+	page := c.NewPage()
+	form := pdf.NewPdfAcroForm()
+	form.Fields = &[]*pdf.PdfField{}
+
+	name, err := annotator.NewTextField(page, "name", []float64{50, 700, 300, 720}, annotator.TextFieldOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fruit, err := annotator.NewComboboxField(page, "fruit", []float64{50, 650, 300, 670},
+		annotator.ComboboxFieldOptions{Choices: []string{"Apple", "Banana"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []*pdf.PdfField{name.PdfField, fruit.PdfField} {
+		*form.Fields = append(*form.Fields, field)
+		page.AddAnnotation(field.Annotations[0].PdfAnnotation)
+	}
+	if err := c.SetForms(form); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := c.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// testPageText returns the text of the page of the pdf.
+func testPageText(t *testing.T, pdfData []byte, pageNum int) string {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := pdfReader.GetPage(pageNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex, err := extractor.New(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageText, _, _, err := ex.ExtractPageText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pageText.Text()
+}
+
+func TestFillFormRefillFlatten(t *testing.T) {
+	first, err := FillForm(testFormPdf(t), map[string]interface{}{
+		"name":  "Zhang San",
+		"fruit": "Apple",
+	}, FillOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fields have appearances of the first values now, which filling
+	// in other values must not keep
+	out, err := FillForm(first, map[string]interface{}{
+		"name":  "Li Si",
+		"fruit": "Banana",
+	}, FillOptions{Flatten: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdfReader.AcroForm != nil && len(pdfReader.AcroForm.AllFields()) > 0 {
+		t.Errorf("flattened pdf has form fields")
+	}
+	text := testPageText(t, out, 1)
+	for _, want := range []string{"Li Si", "Banana"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("page text %q lacks %q", text, want)
+		}
+	}
+	for _, stale := range []string{"Zhang San", "Apple"} {
+		if strings.Contains(text, stale) {
+			t.Errorf("page text %q has the old value %q", text, stale)
+		}
+	}
+}
+
+func TestFillFormFieldErrors(t *testing.T) {
+	tests := []struct {
+		values map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"other": "x"}, `Field "other": not in the form`},
+		{map[string]interface{}{"name": true}, `Field "name": text needs a string`},
+		{map[string]interface{}{"fruit": 1.0}, `Field "fruit": choice needs a string or a list of strings`},
+	}
+	formPdf := testFormPdf(t)
+	for _, test := range tests {
+		_, err := FillForm(formPdf, test.values, FillOptions{})
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%v: error %v, want %q", test.values, err, test.err)
+		}
+	}
+	if _, err := FillForm(testPdf(t, 1), map[string]interface{}{"name": "x"}, FillOptions{}); err != errNoForm {
+		t.Errorf("pdf without form: error %v, want %v", err, errNoForm)
+	}
+}
@@ -0,0 +1,290 @@
+package filesman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/unidoc/unipdf/creator"
+	"image"
+	"net/http"
+	"strings"
+)
+
+const (
+	PAGE_A4     = "a4"
+	PAGE_LETTER = "letter"
+	PAGE_FIT    = "fit" // the image size plus margins
+)
+
+const (
+	ORIENT_AUTO      = "auto" // landscape for wide images
+	ORIENT_PORTRAIT  = "portrait"
+	ORIENT_LANDSCAPE = "landscape"
+)
+
+// ImagePageOptions says how images are put on pages of their own.
+type ImagePageOptions struct {
+	Size        string
+	Margin      float64 // points
+	Orientation string
+}
+
+var errImageMargin = errors.New("Margin too large")
+
+var defaultImagePage = ImagePageOptions{Size: PAGE_A4, Margin: IMAGE_PAGE_MARGIN, Orientation: ORIENT_AUTO}
+
+// exifOrientation returns the EXIF orientation of a jpeg, 1 when it has
+// none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || size < 2 || i+2+size > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag of the first IFD of EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < count; k++ {
+		entry := ifd + 2 + 12*k
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
+
+// orientImage turns an image as its EXIF orientation says it is shown.
+func orientImage(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// newOrientedImage loads an image upright, as its EXIF orientation says.
+func newOrientedImage(c *creator.Creator, imgData []byte) (*creator.Image, error) {
+	orientation := exifOrientation(imgData)
+	if orientation == 1 {
+		return c.NewImageFromData(imgData)
+	}
+	src, _, err := image.Decode(bytes.NewReader(imgData))
+	if err != nil {
+		return nil, err
+	}
+	return c.NewImageFromGoImage(orientImage(src, orientation))
+}
+
+// addImagePage adds a page with the image centered and shrunk to fit
+// within the margins.
+func addImagePage(c *creator.Creator, imgData []byte, opts ImagePageOptions) error {
+	img, err := newOrientedImage(c, imgData)
+	if err != nil {
+		return err
+	}
+	var size creator.PageSize
+	switch opts.Size {
+	case PAGE_FIT:
+		size = creator.PageSize{img.Width() + 2*opts.Margin, img.Height() + 2*opts.Margin}
+	case PAGE_LETTER:
+		size = creator.PageSizeLetter
+	default:
+		size = creator.PageSizeA4
+	}
+	if opts.Size != PAGE_FIT {
+		landscape := img.Width() > img.Height()
+		switch opts.Orientation {
+		case ORIENT_PORTRAIT:
+			landscape = false
+		case ORIENT_LANDSCAPE:
+			landscape = true
+		}
+		if landscape {
+			size = creator.PageSize{size[1], size[0]}
+		}
+	}
+	maxw, maxh := size[0]-2*opts.Margin, size[1]-2*opts.Margin
+	if maxw <= 0 || maxh <= 0 {
+		return errImageMargin
+	}
+	c.SetPageSize(size)
+	c.NewPage()
+
+	if img.Width() > maxw || img.Height() > maxh {
+		if img.Width()/img.Height() > maxw/maxh {
+			img.ScaleToWidth(maxw)
+		} else {
+			img.ScaleToHeight(maxh)
+		}
+	}
+	img.SetPos((size[0]-img.Width())/2, (size[1]-img.Height())/2)
+	return c.Draw(img)
+}
+
+// ImagesToPdf puts each image on a page of its own, in order.
+func ImagesToPdf(images [][]byte, opts ImagePageOptions) ([]byte, error) {
+	c := creator.New()
+	for _, imgData := range images {
+		if err := addImagePage(c, imgData, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// ImagesToPdf converts the stored images listed, as a json array, by the
+// images parameter into a pdf and stores it for the caller. The size
+// parameter is a4, letter or fit, orientation auto, portrait or landscape
+// and margin in points.
+func (filesman *Filesman) ImagesToPdf(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	var names []string
+	if err := json.Unmarshal([]byte(c.PostForm("images")), &names); err != nil || len(names) == 0 || len(names) > MAX_MERGE_PARTS {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params images error",
+		})
+		return
+	}
+	opts := ImagePageOptions{
+		Size:        strings.ToLower(c.DefaultPostForm("size", PAGE_A4)),
+		Orientation: strings.ToLower(c.DefaultPostForm("orientation", ORIENT_AUTO)),
+	}
+	switch opts.Size {
+	case PAGE_A4, PAGE_LETTER, PAGE_FIT:
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params size error",
+		})
+		return
+	}
+	switch opts.Orientation {
+	case ORIENT_AUTO, ORIENT_PORTRAIT, ORIENT_LANDSCAPE:
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params orientation error",
+		})
+		return
+	}
+	var err error
+	opts.Margin, err = paramFloat(c.PostForm("margin"), IMAGE_PAGE_MARGIN)
+	if err != nil || opts.Margin < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params margin error",
+		})
+		return
+	}
+
+	images := make([][]byte, len(names))
+	for i, name := range names {
+		filename, err := GenFilename(c, name)
+		if err != nil {
+			return
+		}
+		images[i], err = filesman.ReadFile(filename)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Can not read " + name,
+			})
+			return
+		}
+		switch http.DetectContentType(images[i]) {
+		case "image/jpeg", "image/gif", "image/png":
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Invalid file type " + name,
+			})
+			return
+		}
+	}
+
+	out, err := ImagesToPdf(images, opts)
+	if err != nil {
+		msg := "Convert error"
+		if err == errImageMargin {
+			msg = err.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": msg,
+		})
+		return
+	}
+	filesman.sendPdf(c, OUTPUT_STORE, out)
+}
@@ -0,0 +1,205 @@
+package filesman
+
+import (
+	"github.com/gin-gonic/gin"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"github.com/unidoc/unipdf/core"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+	"time"
+)
+
+// PageInfo is the size, in points as shown, and rotation of a page.
+type PageInfo struct {
+	Page   int     `json:"page"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Rotate int     `json:"rotate"`
+}
+
+// FieldInfo is a form field and its value.
+type FieldInfo struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"` // text, button, choice or signature
+	Value string `json:"value"`
+}
+
+// DocInfo is the document information dictionary.
+type DocInfo struct {
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	Subject  string    `json:"subject"`
+	Keywords string    `json:"keywords"`
+	Creator  string    `json:"creator"`
+	Producer string    `json:"producer"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+// PdfInspection describes a pdf. Locked is set for a pdf encrypted with a
+// user password, of which nothing more can be read.
+type PdfInspection struct {
+	Version    string            `json:"version"`
+	Encrypted  bool              `json:"encrypted"`
+	Locked     bool              `json:"locked"`
+	NumPages   int               `json:"numpages"`
+	Pages      []PageInfo        `json:"pages"`
+	Info       DocInfo           `json:"info"`
+	Fields     []FieldInfo       `json:"fields"`
+	Signatures []SignatureReport `json:"signatures"`
+}
+
+func decodedString(s *core.PdfObjectString) string {
+	if s == nil {
+		return ""
+	}
+	return s.Decoded()
+}
+
+func fieldValue(v core.PdfObject) string {
+	switch v := core.TraceToDirectObject(v).(type) {
+	case *core.PdfObjectString:
+		return v.Decoded()
+	case *core.PdfObjectName:
+		return string(*v)
+	}
+	return ""
+}
+
+// PdfPageCount returns the page count of a pdf, 0 when it can not be read.
+func PdfPageCount(pdfData []byte) int {
+	pdfReader, _, err := openPdf(pdfData, "", 0)
+	if err != nil {
+		return 0
+	}
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return 0
+	}
+	return numPages
+}
+
+// InspectPdf describes the pdf, checking its signatures against the trust
+// roots.
+func InspectPdf(pdfData []byte, roots *smx509.CertPool) (*PdfInspection, error) {
+	pdfReader, encrypted, err := openPdf(pdfData, "", 0)
+	report := &PdfInspection{
+		Encrypted:  encrypted,
+		Pages:      []PageInfo{},
+		Fields:     []FieldInfo{},
+		Signatures: []SignatureReport{},
+	}
+	if err == errPdfPassword {
+		report.Locked = true
+		return report, nil
+	} else if err != nil {
+		return nil, err
+	}
+	report.Version = pdfReader.PdfVersion().String()
+
+	report.NumPages, err = pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	for n := 1; n <= report.NumPages; n++ {
+		page, err := pdfReader.GetPage(n)
+		if err != nil {
+			return nil, err
+		}
+		frame, err := newPageFrame(page)
+		if err != nil {
+			return nil, err
+		}
+		report.Pages = append(report.Pages, PageInfo{
+			Page:   n,
+			Width:  frame.width,
+			Height: frame.height,
+			Rotate: frame.rotate,
+		})
+	}
+
+	if info, err := pdfReader.GetPdfInfo(); err == nil && info != nil {
+		report.Info = DocInfo{
+			Title:    decodedString(info.Title),
+			Author:   decodedString(info.Author),
+			Subject:  decodedString(info.Subject),
+			Keywords: decodedString(info.Keywords),
+			Creator:  decodedString(info.Creator),
+			Producer: decodedString(info.Producer),
+		}
+		if info.CreationDate != nil {
+			report.Info.Created = info.CreationDate.ToGoTime()
+		}
+		if info.ModifiedDate != nil {
+			report.Info.Modified = info.ModifiedDate.ToGoTime()
+		}
+	}
+
+	if pdfReader.AcroForm != nil {
+		for _, field := range pdfReader.AcroForm.AllFields() {
+			name, err := field.FullName()
+			if err != nil {
+				name = field.PartialName()
+			}
+			f := FieldInfo{Name: name}
+			switch field.GetContext().(type) {
+			case *pdf.PdfFieldText:
+				f.Type = "text"
+			case *pdf.PdfFieldButton:
+				f.Type = "button"
+			case *pdf.PdfFieldChoice:
+				f.Type = "choice"
+			case *pdf.PdfFieldSignature:
+				f.Type = "signature"
+			}
+			if f.Type != "signature" {
+				f.Value = fieldValue(field.V)
+			}
+			report.Fields = append(report.Fields, f)
+		}
+	}
+
+	verified := verifyPdfReader(pdfReader, pdfData, roots)
+	report.Signatures = verified.Signatures
+	return report, nil
+}
+
+// Inspect describes a stored pdf, see PdfInspection.
+func (filesman *Filesman) Inspect(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	filename := c.Param("filename")
+
+	filenameReal, err := GenFilename(c, filename)
+	if err != nil {
+		return
+	}
+	pdfData, err := filesman.ReadFile(filenameReal)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+	if http.DetectContentType(pdfData) != PDF_TYPE {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Invalid file type",
+		})
+		return
+	}
+
+	report, err := InspectPdf(pdfData, filesman.TrustRoots)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Invalid pdf",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"inspect": report,
+	})
+}
@@ -0,0 +1,126 @@
+package filesman
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+)
+
+const (
+	IMAGE_PAGE_MARGIN = 36 // points around images put on pages of their own
+	MAX_MERGE_PARTS   = 100
+)
+
+// MergePart is one input of MergePdf, a stored file in Merge. Of a pdf the
+// pages selected by Page are taken, all when zero, an image is put on a
+// page of its own.
+type MergePart struct {
+	File string       `json:"file"`
+	Page PageSelector `json:"page"`
+	Data []byte       `json:"-"`
+}
+
+// MergePdf joins the parts, in order, into a single pdf.
+func MergePdf(parts []MergePart) ([]byte, error) {
+	c := creator.New()
+	for _, part := range parts {
+		if http.DetectContentType(part.Data) != PDF_TYPE {
+			if err := addImagePage(c, part.Data, defaultImagePage); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		pdfReader, err := pdf.NewPdfReader(bytes.NewReader(part.Data))
+		if err != nil {
+			return nil, err
+		}
+		numPages, err := pdfReader.GetNumPages()
+		if err != nil {
+			return nil, err
+		}
+		sel := part.Page
+		if sel.IsZero() {
+			sel, _ = ParsePageSelector("all")
+		}
+		pages, err := sel.Pages(numPages)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range pages {
+			page, err := pdfReader.GetPage(n)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.AddPage(page); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Merge joins the stored files listed, as json MergeParts, by the files
+// parameter and stores the result for the caller.
+func (filesman *Filesman) Merge(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	var parts []MergePart
+	if err := json.Unmarshal([]byte(c.PostForm("files")), &parts); err != nil || len(parts) == 0 || len(parts) > MAX_MERGE_PARTS {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params files error",
+		})
+		return
+	}
+
+	for i := range parts {
+		filename, err := GenFilename(c, parts[i].File)
+		if err != nil {
+			return
+		}
+		parts[i].Data, err = filesman.ReadFile(filename)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Can not read " + parts[i].File,
+			})
+			return
+		}
+		switch http.DetectContentType(parts[i].Data) {
+		case PDF_TYPE:
+		case "image/jpeg", "image/gif", "image/png":
+			if !parts[i].Page.IsZero() {
+				c.JSON(http.StatusOK, gin.H{
+					"status":  "error",
+					"message": "Params page error",
+				})
+				return
+			}
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Invalid file type " + parts[i].File,
+			})
+			return
+		}
+	}
+
+	out, err := MergePdf(parts)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": stampErrorMessage(err, "Merge error"),
+		})
+		return
+	}
+	filesman.sendPdf(c, OUTPUT_STORE, out)
+}
@@ -0,0 +1,278 @@
+package filesman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/minio/sha256-simd"
+	"github.com/unidoc/unipdf/annotator"
+	"github.com/unidoc/unipdf/core"
+	pdf "github.com/unidoc/unipdf/model"
+	"image"
+	"net/http"
+	"time"
+)
+
+const PADES_SUBFILTER = "ETSI.CAdES.detached"
+
+var errSignPage = errors.New("signature page must select a single page")
+
+// padesHandler signs PDF signatures with a Signer, as PAdES baseline B.
+type padesHandler struct {
+	signer *Signer
+}
+
+func (handler *padesHandler) IsApplicable(sig *pdf.PdfSignature) bool {
+	return false
+}
+
+func (handler *padesHandler) Validate(sig *pdf.PdfSignature, digest pdf.Hasher) (pdf.SignatureValidationResult, error) {
+	return pdf.SignatureValidationResult{}, errors.New("pades handler only signs")
+}
+
+func (handler *padesHandler) InitSignature(sig *pdf.PdfSignature) error {
+	h := *handler
+	sig.Handler = &h
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName(PADES_SUBFILTER)
+	sig.Reference = nil
+	// reserve the space of the signature, filled in by Sign
+	sig.Contents = core.MakeHexString(string(make([]byte, handler.signer.signatureSize())))
+	return nil
+}
+
+// NewDigest collects the signed byte ranges, the CMS signature digests
+// them itself.
+func (handler *padesHandler) NewDigest(sig *pdf.PdfSignature) (pdf.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+func (handler *padesHandler) Sign(sig *pdf.PdfSignature, digest pdf.Hasher) error {
+	buffer, ok := digest.(*bytes.Buffer)
+	if !ok {
+		return errors.New("unexpected digest")
+	}
+	signature, err := handler.signer.SignDetached(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	size := handler.signer.signatureSize()
+	if len(signature) > size {
+		return errors.New("signature too big")
+	}
+	data := make([]byte, size)
+	copy(data, signature)
+	sig.Contents = core.MakeHexString(string(data))
+	return nil
+}
+
+// SignOptions places the visible signature and fills the signature
+// dictionary. Without Image the signature is invisible.
+type SignOptions struct {
+	Page     PageSelector // a single page, the first when zero
+	Xpos     float64      // upper left corner of the seal, from the upper left corner of the page
+	Ypos     float64
+	Width    float64
+	Image    []byte
+	Reason   string
+	Location string
+}
+
+// SignPdf applies a PAdES digital signature to the pdf, incrementally so
+// earlier signatures stay valid.
+func SignPdf(pdfData []byte, signer *Signer, opts SignOptions) ([]byte, error) {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	sel := opts.Page
+	if sel.IsZero() {
+		sel, _ = ParsePageSelector("1")
+	}
+	pages, err := sel.Pages(numPages)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) != 1 {
+		return nil, errSignPage
+	}
+	page, err := pdfReader.GetPage(pages[0])
+	if err != nil {
+		return nil, err
+	}
+	mbox, err := page.GetMediaBox()
+	if err != nil {
+		return nil, err
+	}
+
+	fieldOpts := annotator.NewSignatureFieldOpts()
+	fieldOpts.Rect = []float64{0, 0, 0, 0}
+	if len(opts.Image) > 0 {
+		img, _, err := image.Decode(bytes.NewReader(opts.Image))
+		if err != nil {
+			return nil, err
+		}
+		bounds := img.Bounds()
+		height := opts.Width * float64(bounds.Dy()) / float64(bounds.Dx())
+		fieldOpts.Rect = []float64{
+			mbox.Llx + opts.Xpos,
+			mbox.Ury - opts.Ypos - height,
+			mbox.Llx + opts.Xpos + opts.Width,
+			mbox.Ury - opts.Ypos,
+		}
+		fieldOpts.Image = img
+	}
+
+	appender, err := pdf.NewPdfAppender(pdfReader)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	signature := pdf.NewPdfSignature(&padesHandler{signer: signer})
+	signature.SetName(signer.Name)
+	signature.SetDate(now, "")
+	if opts.Reason != "" {
+		signature.SetReason(opts.Reason)
+	}
+	if opts.Location != "" {
+		signature.SetLocation(opts.Location)
+	}
+	if err := signature.Initialize(); err != nil {
+		return nil, err
+	}
+
+	field, err := annotator.NewSignatureField(signature, nil, fieldOpts)
+	if err != nil {
+		return nil, err
+	}
+	field.T = core.MakeString(fmt.Sprintf("Signature%d", now.UnixNano()))
+	if err := appender.Sign(pages[0], field); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = appender.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (filesman *Filesman) Sign(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	if filesman.Signer == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Signing not configured",
+		})
+		return
+	}
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	pdffile, err := GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	opts := SignOptions{
+		Reason:   c.PostForm("reason"),
+		Location: c.PostForm("location"),
+	}
+	if image := c.PostForm("image"); image != "" {
+		image, err = GenFilename(c, image)
+		if err != nil {
+			return
+		}
+		opts.Image, err = filesman.ReadFile(image)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Can not read image",
+			})
+			return
+		}
+	}
+	if page := c.PostForm("page"); page != "" {
+		opts.Page, err = ParsePageSelector(page)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params page error",
+			})
+			return
+		}
+	}
+	floats := []struct {
+		name  string
+		value *float64
+		def   float64
+	}{
+		{"xpos", &opts.Xpos, 0},
+		{"ypos", &opts.Ypos, 0},
+		{"width", &opts.Width, 100},
+	}
+	for _, f := range floats {
+		*f.value, err = paramFloat(c.PostForm(f.name), f.def)
+		if err != nil || *f.value < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params " + f.name + " error",
+			})
+			return
+		}
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	out, err := SignPdf(pdfData, filesman.Signer, opts)
+	if err == errSignPage {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params page error",
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": stampErrorMessage(err, "Sign error"),
+		})
+		return
+	}
+
+	hash := sha256.Sum256(append([]byte(pdffile+"sign"), out...))
+	outfile := fmt.Sprintf("%x", hash) + ".pdf"
+	outfileReal, err := GenFilename(c, outfile)
+	if err != nil {
+		return
+	}
+	if _, err := filesman.StoreFile(outfileReal, out, PDF_TYPE, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not write file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "ok",
+		"resultfile": outfile,
+	})
+}
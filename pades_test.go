@@ -0,0 +1,50 @@
+package filesman
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignPdfVerify(t *testing.T) {
+	for _, alg := range []string{SIGN_RSA, SIGN_SM2} {
+		signer, roots := testSigner(t, alg)
+		signed, err := SignPdf(testPdf(t, 2), signer, SignOptions{Reason: "approved"})
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		report, err := VerifyPdf(signed, roots)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if len(report.Signatures) != 1 {
+			t.Fatalf("%s: %d signatures", alg, len(report.Signatures))
+		}
+		r := report.Signatures[0]
+		if !r.Intact || !r.Trusted || !r.CoversDocument || len(r.Errors) > 0 {
+			t.Errorf("%s: %+v", alg, r)
+		}
+		if r.Alg != alg || r.Signer != signer.Name || r.Reason != "approved" || r.SubFilter != PADES_SUBFILTER {
+			t.Errorf("%s: %+v", alg, r)
+		}
+		if !report.Valid || report.Modified {
+			t.Errorf("%s: valid %v, modified %v", alg, report.Valid, report.Modified)
+		}
+
+		// flip a byte of the binary comment after the header, which is
+		// signed and leaves the pdf readable
+		i := bytes.IndexByte(signed, '\n') + 1
+		if i == 0 || i+1 >= len(signed) || signed[i] != '%' {
+			t.Fatalf("%s: no comment after the header", alg)
+		}
+		tampered := append([]byte{}, signed...)
+		tampered[i+1] ^= 1
+		report, err = VerifyPdf(tampered, roots)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if len(report.Signatures) != 1 || report.Signatures[0].Intact || report.Valid {
+			t.Errorf("%s: tampered pdf: %+v", alg, report)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package filesman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+)
+
+const (
+	EDIT_ROTATE = "rotate"
+	EDIT_DELETE = "delete"
+	EDIT_MOVE   = "move"
+	EDIT_INSERT = "insert" // a blank A4 page
+)
+
+const MAX_PAGE_EDITS = 1000
+
+// PageEdit is one edit of EditPages. Pages are numbered as in the original
+// document, whatever edits came before. A move puts the pages, in order,
+// before the Before page or at the end when it is zero. An insert adds a
+// blank page after the Page page or before the Before page.
+type PageEdit struct {
+	Op     string       `json:"op"`
+	Page   PageSelector `json:"page"`
+	Angle  int          `json:"angle"` // clockwise, a multiple of 90
+	Before PageSelector `json:"before"`
+}
+
+// PageEditError reports an edit that can not be applied.
+type PageEditError struct {
+	Edit   int // counting from 1
+	Reason string
+}
+
+func (err *PageEditError) Error() string {
+	return fmt.Sprintf("Edit %d: %s", err.Edit, err.Reason)
+}
+
+// pageSlot is a page of the edited document, page 0 being a blank one.
+type pageSlot struct {
+	page   int
+	rotate int
+}
+
+type pageSlots []pageSlot
+
+// find returns the index of the original page n, -1 when deleted.
+func (slots pageSlots) find(n int) int {
+	for i, slot := range slots {
+		if slot.page == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// single resolves a selector of one page that must not be deleted.
+func (slots pageSlots) single(sel PageSelector, numPages int) (int, error) {
+	pages, err := sel.Pages(numPages)
+	if err != nil {
+		return 0, err
+	}
+	if len(pages) != 1 {
+		return 0, fmt.Errorf("%q is not a single page", sel.String())
+	}
+	i := slots.find(pages[0])
+	if i < 0 {
+		return 0, fmt.Errorf("page %d was deleted", pages[0])
+	}
+	return i, nil
+}
+
+// apply applies one edit to the slots.
+func (slots pageSlots) apply(edit PageEdit, numPages int) (pageSlots, error) {
+	var pages []int
+	if !edit.Page.IsZero() {
+		var err error
+		pages, err = edit.Page.Pages(numPages)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range pages {
+			if slots.find(n) < 0 {
+				return nil, fmt.Errorf("page %d was deleted", n)
+			}
+		}
+	}
+
+	switch edit.Op {
+	case EDIT_ROTATE:
+		if len(pages) == 0 || edit.Angle%90 != 0 {
+			return nil, fmt.Errorf("rotate needs pages and an angle in steps of 90")
+		}
+		for _, n := range pages {
+			slot := &slots[slots.find(n)]
+			slot.rotate = ((slot.rotate+edit.Angle)%360 + 360) % 360
+		}
+	case EDIT_DELETE:
+		if len(pages) == 0 {
+			return nil, fmt.Errorf("delete needs pages")
+		}
+		for _, n := range pages {
+			i := slots.find(n)
+			slots = append(slots[:i], slots[i+1:]...)
+		}
+	case EDIT_MOVE:
+		if len(pages) == 0 {
+			return nil, fmt.Errorf("move needs pages")
+		}
+		target := 0
+		if !edit.Before.IsZero() {
+			i, err := slots.single(edit.Before, numPages)
+			if err != nil {
+				return nil, err
+			}
+			target = slots[i].page
+			for _, n := range pages {
+				if n == target {
+					return nil, fmt.Errorf("page %d moved before itself", n)
+				}
+			}
+		}
+		var moved pageSlots
+		for _, n := range pages {
+			i := slots.find(n)
+			moved = append(moved, slots[i])
+			slots = append(slots[:i], slots[i+1:]...)
+		}
+		at := len(slots)
+		if target > 0 {
+			at = slots.find(target)
+		}
+		slots = append(slots[:at], append(moved, slots[at:]...)...)
+	case EDIT_INSERT:
+		var at int
+		switch {
+		case !edit.Page.IsZero() && edit.Before.IsZero():
+			i, err := slots.single(edit.Page, numPages)
+			if err != nil {
+				return nil, err
+			}
+			at = i + 1
+		case edit.Page.IsZero() && !edit.Before.IsZero():
+			i, err := slots.single(edit.Before, numPages)
+			if err != nil {
+				return nil, err
+			}
+			at = i
+		default:
+			return nil, fmt.Errorf("insert needs either page or before")
+		}
+		slots = append(slots[:at], append(pageSlots{{}}, slots[at:]...)...)
+	default:
+		return nil, fmt.Errorf("unknown op %q", edit.Op)
+	}
+	return slots, nil
+}
+
+// EditPages applies the edits, in order, and returns the new pdf.
+func EditPages(pdfData []byte, edits []PageEdit) ([]byte, error) {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make(pageSlots, numPages)
+	for i := range slots {
+		slots[i].page = i + 1
+	}
+	for i, edit := range edits {
+		slots, err = slots.apply(edit, numPages)
+		if err != nil {
+			if _, ok := err.(*PageRangeError); ok {
+				return nil, err
+			}
+			return nil, &PageEditError{Edit: i + 1, Reason: err.Error()}
+		}
+	}
+	if len(slots) == 0 {
+		return nil, &PageEditError{Edit: len(edits), Reason: "no pages left"}
+	}
+
+	c := creator.New()
+	for _, slot := range slots {
+		if slot.page == 0 {
+			c.SetPageSize(creator.PageSizeA4)
+			c.NewPage()
+			continue
+		}
+		page, err := pdfReader.GetPage(slot.page)
+		if err != nil {
+			return nil, err
+		}
+		if slot.rotate != 0 {
+			var rotate int64
+			if page.Rotate != nil {
+				rotate = *page.Rotate
+			}
+			rotate = ((rotate+int64(slot.rotate))%360 + 360) % 360
+			page.Rotate = &rotate
+		}
+		if err := c.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// EditPages applies the json PageEdits of the edits parameter to a stored
+// pdf and stores the result for the caller.
+func (filesman *Filesman) EditPages(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	var edits []PageEdit
+	if err := json.Unmarshal([]byte(c.PostForm("edits")), &edits); err != nil || len(edits) == 0 || len(edits) > MAX_PAGE_EDITS {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params edits error",
+		})
+		return
+	}
+	pdffile, err := GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	out, err := EditPages(pdfData, edits)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": stampErrorMessage(err, "Edit error"),
+		})
+		return
+	}
+	filesman.sendPdf(c, OUTPUT_STORE, out)
+}
@@ -0,0 +1,215 @@
+package filesman
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageRangeError reports a selected page outside of the document, Selector
+// being the part of the selector as given.
+type PageRangeError struct {
+	Selector string
+	Page     int
+	NumPages int
+}
+
+func (err *PageRangeError) Error() string {
+	return fmt.Sprintf("Page %s out of range 1-%d", err.Selector, err.NumPages)
+}
+
+const (
+	termRange = iota
+	termAll
+	termOdd
+	termEven
+	termAllButFirst
+	termAllButLast
+)
+
+// pageTerm is one comma separated part of a selector. Page numbers above
+// zero count from the first page, zero and below from the last page, so 0 is
+// the last page and -1 the second to last.
+type pageTerm struct {
+	kind     int
+	from, to int
+	text     string
+}
+
+// PageSelector selects pages with a comma separated list of page numbers,
+// ranges like "3-5" or "2-last", "last", negative numbers counting from the
+// end ("-2" is the second to last page), "odd", "even", "all",
+// "all-but-first" and "all-but-last". "-1" selects all pages as it always
+// has.
+type PageSelector struct {
+	text  string
+	terms []pageTerm
+}
+
+func parsePageNum(s string) (int, error) {
+	if strings.EqualFold(s, "last") {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case n > 0:
+		return n, nil
+	case n < -1:
+		return n + 1, nil
+	}
+	return 0, fmt.Errorf("invalid page %s", s)
+}
+
+// ParsePageSelector parses a selector, checking its syntax only. Pages are
+// checked against the document by Pages.
+func ParsePageSelector(s string) (PageSelector, error) {
+	sel := PageSelector{text: s}
+	for _, text := range strings.Split(s, ",") {
+		text = strings.TrimSpace(text)
+		part := strings.ToLower(text)
+		switch part {
+		case "":
+			return PageSelector{}, fmt.Errorf("empty page selector %q", s)
+		case "all", "-1":
+			sel.terms = append(sel.terms, pageTerm{kind: termAll})
+			continue
+		case "odd":
+			sel.terms = append(sel.terms, pageTerm{kind: termOdd})
+			continue
+		case "even":
+			sel.terms = append(sel.terms, pageTerm{kind: termEven})
+			continue
+		case "all-but-first":
+			sel.terms = append(sel.terms, pageTerm{kind: termAllButFirst})
+			continue
+		case "all-but-last":
+			sel.terms = append(sel.terms, pageTerm{kind: termAllButLast})
+			continue
+		}
+
+		// a range, the dash of a negative page number is at index 0
+		from, to := part, part
+		if i := strings.Index(part[1:], "-"); i >= 0 {
+			from, to = part[:i+1], part[i+2:]
+		}
+		f, err := parsePageNum(from)
+		if err != nil {
+			return PageSelector{}, fmt.Errorf("invalid page selector %q", s)
+		}
+		t, err := parsePageNum(to)
+		if err != nil {
+			return PageSelector{}, fmt.Errorf("invalid page selector %q", s)
+		}
+		sel.terms = append(sel.terms, pageTerm{kind: termRange, from: f, to: t, text: text})
+	}
+	return sel, nil
+}
+
+func (sel PageSelector) String() string {
+	return sel.text
+}
+
+// IsZero reports whether no selector was given.
+func (sel PageSelector) IsZero() bool {
+	return len(sel.terms) == 0
+}
+
+// Pages resolves the selector for a document of numPages pages and returns
+// the selected page numbers in order, without duplicates.
+func (sel PageSelector) Pages(numPages int) ([]int, error) {
+	selected := make([]bool, numPages+1)
+	abs := func(n int, term pageTerm) (int, error) {
+		if n <= 0 {
+			n += numPages
+		}
+		if n < 1 || n > numPages {
+			return 0, &PageRangeError{Selector: term.text, Page: n, NumPages: numPages}
+		}
+		return n, nil
+	}
+	for _, term := range sel.terms {
+		switch term.kind {
+		case termRange:
+			from, err := abs(term.from, term)
+			if err != nil {
+				return nil, err
+			}
+			to, err := abs(term.to, term)
+			if err != nil {
+				return nil, err
+			}
+			if from > to {
+				return nil, fmt.Errorf("invalid page range %s", term.text)
+			}
+			for i := from; i <= to; i++ {
+				selected[i] = true
+			}
+		default:
+			for i := 1; i <= numPages; i++ {
+				switch term.kind {
+				case termAll:
+				case termOdd:
+					if i%2 == 0 {
+						continue
+					}
+				case termEven:
+					if i%2 == 1 {
+						continue
+					}
+				case termAllButFirst:
+					if i == 1 {
+						continue
+					}
+				case termAllButLast:
+					if i == numPages {
+						continue
+					}
+				}
+				selected[i] = true
+			}
+		}
+	}
+
+	var pages []int
+	for i := 1; i <= numPages; i++ {
+		if selected[i] {
+			pages = append(pages, i)
+		}
+	}
+	return pages, nil
+}
+
+// PageNumSelector returns the selector of a page number as taken by
+// AddImageToPdf, -1 selecting all pages.
+func PageNumSelector(pageNum int) (PageSelector, error) {
+	if pageNum != -1 && pageNum < 1 {
+		return PageSelector{}, fmt.Errorf("invalid page %d", pageNum)
+	}
+	return ParsePageSelector(strconv.Itoa(pageNum))
+}
+
+// UnmarshalJSON accepts a selector string or a plain page number.
+func (sel *PageSelector) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int
+		if err := json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		s = strconv.Itoa(n)
+	}
+	parsed, err := ParsePageSelector(s)
+	if err != nil {
+		return err
+	}
+	*sel = parsed
+	return nil
+}
+
+func (sel PageSelector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sel.text)
+}
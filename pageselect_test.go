@@ -0,0 +1,79 @@
+package filesman
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPages(t *testing.T) {
+	tests := []struct {
+		selector string
+		numPages int
+		pages    []int
+		err      string
+	}{
+		{"1", 5, []int{1}, ""},
+		{"1,3-4", 5, []int{1, 3, 4}, ""},
+		{"3-5,1-3", 5, []int{1, 2, 3, 4, 5}, ""},
+		{"last", 5, []int{5}, ""},
+		{"2-last", 5, []int{2, 3, 4, 5}, ""},
+		{"-2", 5, []int{4}, ""},
+		{"-3--2", 5, []int{3, 4}, ""},
+		{"-1", 3, []int{1, 2, 3}, ""},
+		{"all", 3, []int{1, 2, 3}, ""},
+		{"odd", 5, []int{1, 3, 5}, ""},
+		{"even", 5, []int{2, 4}, ""},
+		{"all-but-first", 4, []int{2, 3, 4}, ""},
+		{"all-but-last", 4, []int{1, 2, 3}, ""},
+		{"All-But-First, 1", 3, []int{1, 2, 3}, ""},
+		{"all-but-first", 1, nil, ""},
+		{"6", 5, nil, "Page 6 out of range 1-5"},
+		{"1, -4", 3, nil, "Page -4 out of range 1-3"},
+		{"2-9", 5, nil, "Page 2-9 out of range 1-5"},
+		{"4-2", 5, nil, "invalid page range 4-2"},
+	}
+	for _, test := range tests {
+		sel, err := ParsePageSelector(test.selector)
+		if err != nil {
+			t.Errorf("ParsePageSelector(%q): %v", test.selector, err)
+			continue
+		}
+		pages, err := sel.Pages(test.numPages)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q of %d pages: error %v, want %q", test.selector, test.numPages, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q of %d pages: %v", test.selector, test.numPages, err)
+			continue
+		}
+		if !reflect.DeepEqual(pages, test.pages) {
+			t.Errorf("%q of %d pages: %v, want %v", test.selector, test.numPages, pages, test.pages)
+		}
+	}
+}
+
+func TestParsePageSelectorInvalid(t *testing.T) {
+	for _, selector := range []string{"", "0", "1,", "a", "1-b", "first"} {
+		if _, err := ParsePageSelector(selector); err == nil {
+			t.Errorf("ParsePageSelector(%q) accepted", selector)
+		}
+	}
+}
+
+func TestPageRangeErrorType(t *testing.T) {
+	sel, err := ParsePageSelector("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sel.Pages(2)
+	rangeErr, ok := err.(*PageRangeError)
+	if !ok {
+		t.Fatalf("error %v is not a PageRangeError", err)
+	}
+	if rangeErr.Selector != "7" || rangeErr.Page != 7 || rangeErr.NumPages != 2 {
+		t.Errorf("got %+v", rangeErr)
+	}
+}
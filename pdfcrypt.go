@@ -0,0 +1,259 @@
+package filesman
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/unidoc/unipdf/core/security"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+	"strings"
+)
+
+var errPdfPassword = errors.New("Invalid pdf password")
+
+var errPdfPermission = errors.New("Pdf password lacks permission")
+
+// permissions by name, of the encrypt permissions parameter
+var pdfPermissions = map[string]security.Permissions{
+	"print":         security.PermPrinting,
+	"printhq":       security.PermFullPrintQuality,
+	"modify":        security.PermModify,
+	"copy":          security.PermExtractGraphics,
+	"accessibility": security.PermDisabilityExtract,
+	"annotate":      security.PermAnnotate,
+	"fillforms":     security.PermFillForms,
+	"assemble":      security.PermRotateInsert,
+}
+
+// ParsePermissions parses a comma separated list of permission names, see
+// pdfPermissions. "none" grants none, "all" all of them.
+func ParsePermissions(s string) (security.Permissions, error) {
+	var perms security.Permissions
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "none":
+			continue
+		case "all":
+			for _, perm := range pdfPermissions {
+				perms |= perm
+			}
+			continue
+		}
+		perm, ok := pdfPermissions[name]
+		if !ok {
+			return 0, fmt.Errorf("invalid permission %q", name)
+		}
+		perms |= perm
+	}
+	return perms, nil
+}
+
+// openPdf opens a pdf, decrypting an encrypted one with the password, user
+// or owner, errPdfPassword when it is wrong. The password must grant perms,
+// security.PermOwner asking for the owner password, errPdfPermission when it
+// does not.
+func openPdf(pdfData []byte, password string, perms security.Permissions) (pdfReader *pdf.PdfReader, encrypted bool, err error) {
+	pdfReader, err = pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, false, err
+	}
+	encrypted, err = pdfReader.IsEncrypted()
+	if err != nil || !encrypted {
+		return pdfReader, false, err
+	}
+	ok, err := pdfReader.Decrypt([]byte(password))
+	if err != nil {
+		return nil, true, err
+	}
+	if !ok {
+		return nil, true, errPdfPassword
+	}
+	ok, granted, err := pdfReader.CheckAccessRights([]byte(password))
+	if err != nil {
+		return nil, true, err
+	}
+	if !ok {
+		return nil, true, errPdfPassword
+	}
+	if granted&perms != perms {
+		return nil, true, errPdfPermission
+	}
+	return pdfReader, true, nil
+}
+
+// rewritePdf writes the pages, form and outline of the pdf anew, access
+// being called with the writer before. The document information and XMP
+// metadata are not carried over.
+func rewritePdf(pdfReader *pdf.PdfReader, access func(w *pdf.PdfWriter) error) ([]byte, error) {
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	c := creator.New()
+	for i := 1; i <= numPages; i++ {
+		page, err := pdfReader.GetPage(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+	if pdfReader.AcroForm != nil {
+		if err := c.SetForms(pdfReader.AcroForm); err != nil {
+			return nil, err
+		}
+	}
+	if outline := pdfReader.GetOutlineTree(); outline != nil {
+		c.SetOutlineTree(outline)
+	}
+	if access != nil {
+		c.SetPdfWriterAccessFunc(access)
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// EncryptPdf encrypts the pdf with AES-256. Opening it takes the user
+// password, which may be empty, and grants perms, the owner password grants
+// all. An empty owner password is replaced by a random one. The password
+// opens an already encrypted pdf and must be its owner password.
+func EncryptPdf(pdfData []byte, password string, userPass string, ownerPass string, perms security.Permissions) ([]byte, error) {
+	pdfReader, _, err := openPdf(pdfData, password, security.PermOwner)
+	if err != nil {
+		return nil, err
+	}
+	if ownerPass == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		ownerPass = hex.EncodeToString(b)
+	}
+	return rewritePdf(pdfReader, func(w *pdf.PdfWriter) error {
+		return w.Encrypt([]byte(userPass), []byte(ownerPass), &pdf.EncryptOptions{
+			Permissions: perms,
+			Algorithm:   pdf.AES_256bit,
+		})
+	})
+}
+
+// DecryptPdf returns the pdf without encryption, password being the owner
+// password. The user password gives errPdfPermission, whatever permissions
+// it grants.
+func DecryptPdf(pdfData []byte, password string) ([]byte, error) {
+	pdfReader, encrypted, err := openPdf(pdfData, password, security.PermOwner)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return pdfData, nil
+	}
+	return rewritePdf(pdfReader, nil)
+}
+
+// Encrypt password protects a stored pdf and stores the result for the
+// caller. The userpass parameter opens it with the permissions parameter
+// granted, see ParsePermissions, ownerpass with all. A pdf encrypted
+// already is opened with its owner password. The result keeps the pages,
+// form and outline, not the document information and XMP metadata.
+func (filesman *Filesman) Encrypt(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	userPass, ownerPass := c.PostForm("userpass"), c.PostForm("ownerpass")
+	if userPass == "" && ownerPass == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params userpass error",
+		})
+		return
+	}
+	perms, err := ParsePermissions(c.DefaultPostForm("permissions", "print,printhq"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params permissions error",
+		})
+		return
+	}
+	pdffile, err = GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	out, err := EncryptPdf(pdfData, c.PostForm("password"), userPass, ownerPass, perms)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": stampErrorMessage(err, "Encrypt error"),
+		})
+		return
+	}
+	filesman.sendPdf(c, OUTPUT_STORE, out)
+}
+
+// Decrypt removes the password protection of a stored pdf, opened with the
+// owner password of the password parameter, and stores the result for the
+// caller. The result keeps the pages, form and outline, not the document
+// information and XMP metadata.
+func (filesman *Filesman) Decrypt(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	pdffile, err := GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	out, err := DecryptPdf(pdfData, c.PostForm("password"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": stampErrorMessage(err, "Decrypt error"),
+		})
+		return
+	}
+	filesman.sendPdf(c, OUTPUT_STORE, out)
+}
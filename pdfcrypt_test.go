@@ -0,0 +1,77 @@
+package filesman
+
+import (
+	"bytes"
+	"github.com/unidoc/unipdf/core/security"
+	"github.com/unidoc/unipdf/creator"
+	"testing"
+)
+
+// testPdf returns a pdf of numPages blank pages.
+func testPdf(t *testing.T, numPages int) []byte {
+	c := creator.New()
+	for i := 0; i < numPages; i++ {
+		c.NewPage()
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := c.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDecryptPdfPasswords(t *testing.T) {
+	all, err := ParsePermissions("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptPdf(testPdf(t, 2), "", "user", "owner", all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		password string
+		err      error
+	}{
+		{"user", errPdfPermission},
+		{"other", errPdfPassword},
+		{"", errPdfPassword},
+		{"owner", nil},
+	}
+	for _, test := range tests {
+		out, err := DecryptPdf(encrypted, test.password)
+		if err != test.err {
+			t.Errorf("password %q: error %v, want %v", test.password, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		pdfReader, isEncrypted, err := openPdf(out, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isEncrypted {
+			t.Errorf("password %q: still encrypted", test.password)
+		}
+		if numPages, err := pdfReader.GetNumPages(); err != nil || numPages != 2 {
+			t.Errorf("password %q: %d pages, %v", test.password, numPages, err)
+		}
+	}
+}
+
+func TestEncryptPdfUserPermissions(t *testing.T) {
+	encrypted, err := EncryptPdf(testPdf(t, 1), "", "user", "owner", security.PermPrinting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := openPdf(encrypted, "user", security.PermPrinting); err != nil {
+		t.Errorf("user password printing: %v", err)
+	}
+	if _, _, err := openPdf(encrypted, "user", security.PermModify); err != errPdfPermission {
+		t.Errorf("user password modify: error %v, want %v", err, errPdfPermission)
+	}
+	if _, _, err := openPdf(encrypted, "owner", security.PermModify); err != nil {
+		t.Errorf("owner password modify: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package filesman
+
+import (
+	"bytes"
+	"errors"
+	"github.com/unidoc/unipdf/creator"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// newPerforationStamp cuts the seal image into one vertical strip per
+// selected page, in page order, and places each strip flush with the right
+// edge of its page, so the pages fanned out side by side show the whole
+// seal. Width is the width of the whole seal, Ypos the top of the strips.
+// Setting Unit or Origin measures them on the page as displayed, see
+// perforationLayout, ORIGIN_CENTER centering the strips vertically. Xpos and
+// Rotation are ignored.
+func newPerforationStamp(c *creator.Creator, placement Placement, imgData []byte, pages []int) (func(page int, numPages int) creator.Drawable, error) {
+	src, _, err := image.Decode(bytes.NewReader(imgData))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	n := len(pages)
+	if bounds.Dx() < n {
+		return nil, errors.New("seal image narrower than the page count")
+	}
+
+	strips := make(map[int]*creator.Image)
+	for k, page := range pages {
+		x0 := bounds.Min.X + k*bounds.Dx()/n
+		x1 := bounds.Min.X + (k+1)*bounds.Dx()/n
+		slice := image.NewNRGBA(image.Rect(0, 0, x1-x0, bounds.Dy()))
+		draw.Draw(slice, slice.Bounds(), src, image.Pt(x0, bounds.Min.Y), draw.Src)
+
+		strip, err := c.NewImageFromGoImage(slice)
+		if err != nil {
+			return nil, err
+		}
+		strip.ScaleToWidth(placement.Width * float64(x1-x0) / float64(bounds.Dx()))
+		if placement.Opacity != nil {
+			strip.SetOpacity(*placement.Opacity)
+		}
+		strips[page] = strip
+	}
+
+	return func(page int, numPages int) creator.Drawable {
+		strip := strips[page]
+		strip.SetPos(c.Context().PageWidth-strip.Width(), placement.Ypos)
+		return strip
+	}, nil
+}
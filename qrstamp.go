@@ -0,0 +1,72 @@
+package filesman
+
+import (
+	"github.com/skip2/go-qrcode"
+	"github.com/unidoc/unipdf/creator"
+	"image/color"
+)
+
+// QR_IMAGE_SIZE is the pixel size QR codes are rendered at before scaling
+// to the placement width.
+const QR_IMAGE_SIZE = 512
+
+// QR_DEFAULT_TEXT is the payload of QR placements without text when no
+// verification URL is configured.
+const QR_DEFAULT_TEXT = "sha256:{sha256}\nsm3:{sm3}\naddr:{addr}"
+
+// qrText returns the payload template of a QR placement: its text, else
+// the verification URL, else QR_DEFAULT_TEXT.
+func qrText(placement Placement, opts StampOptions) string {
+	if placement.Text != "" {
+		return placement.Text
+	}
+	if opts.VerifyURL != "" {
+		return opts.VerifyURL
+	}
+	return QR_DEFAULT_TEXT
+}
+
+// newQRStamp returns a function returning the QR code image of a QR
+// placement for each of the pages. The payload is expanded by stampText,
+// codes of the same payload are built once.
+func newQRStamp(c *creator.Creator, placement Placement, opts StampOptions, sha256sum string, sm3sum string, pages []int, numPages int) (func(page int, numPages int) creator.Drawable, error) {
+	r, g, b, err := parseColor(placement.Color)
+	if err != nil {
+		return nil, err
+	}
+	fg := color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
+	text := qrText(placement, opts)
+
+	codes := make(map[string]*creator.Image)
+	images := make(map[int]*creator.Image)
+	for _, page := range pages {
+		payload := stampText(text, opts, sha256sum, sm3sum, page, numPages)
+		img, ok := codes[payload]
+		if !ok {
+			q, err := qrcode.New(payload, qrcode.Medium)
+			if err != nil {
+				return nil, err
+			}
+			q.ForegroundColor = fg
+			img, err = c.NewImageFromGoImage(q.Image(QR_IMAGE_SIZE))
+			if err != nil {
+				return nil, err
+			}
+			img.ScaleToWidth(placement.Width)
+			if placement.Rotation != 0 {
+				img.SetAngle(placement.Rotation)
+			}
+			if placement.Opacity != nil {
+				img.SetOpacity(*placement.Opacity)
+			}
+			codes[payload] = img
+		}
+		images[page] = img
+	}
+
+	return func(page int, numPages int) creator.Drawable {
+		img := images[page]
+		img.SetPos(placement.Xpos, placement.Ypos)
+		return img
+	}, nil
+}
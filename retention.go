@@ -0,0 +1,291 @@
+package filesman
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrLegalHold = errors.New("file is under legal hold")
+
+// FileMeta is stored next to each stored file.
+type FileMeta struct {
+	Type      string    `json:"type"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"` // zero when the upload set no ttl
+	LegalHold bool      `json:"legalhold"`
+	Pages     int       `json:"pages,omitempty"` // of pdfs
+}
+
+// RetentionPolicy expires files of an address and/or content type TTL after
+// upload. Empty Addr or Type matches any.
+type RetentionPolicy struct {
+	Addr string        `json:"addr"`
+	Type string        `json:"type"`
+	TTL  time.Duration `json:"ttl"`
+}
+
+func (policy *RetentionPolicy) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Addr string `json:"addr"`
+		Type string `json:"type"`
+		TTL  string `json:"ttl"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	ttl, err := time.ParseDuration(v.TTL)
+	if err != nil {
+		return err
+	}
+	policy.Addr, policy.Type, policy.TTL = v.Addr, v.Type, ttl
+	return nil
+}
+
+// LoadRetention reads a JSON list of policies such as
+// [{"addr": "", "type": "image/png", "ttl": "720h"}].
+func LoadRetention(path string) ([]RetentionPolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policies []RetentionPolicy
+	err = json.Unmarshal(b, &policies)
+	return policies, err
+}
+
+// SplitFilename splits a real filename into address and file name.
+func SplitFilename(filename string) (addr string, name string) {
+	i := strings.Index(filename, "-")
+	if i < 0 {
+		return "", filename
+	}
+	return filename[:i], filename[i+1:]
+}
+
+func (filesman *Filesman) WriteMeta(filename string, meta *FileMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	metapath := filesman.metaPath(filename, ".json")
+	if err := os.MkdirAll(filepath.Dir(metapath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metapath, b, 0644)
+}
+
+func (filesman *Filesman) ReadMeta(filename string) (*FileMeta, error) {
+	b, err := ioutil.ReadFile(filesman.metaPath(filename, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	meta := new(FileMeta)
+	err = json.Unmarshal(b, meta)
+	return meta, err
+}
+
+// StoreFile writes data of the content type under the real filename with
+// its metadata. Storing a file again keeps its creation time, expiry and
+// legal hold, a positive ttl expiring it that long after creation.
+func (filesman *Filesman) StoreFile(filename string, data []byte, fileType string, ttl time.Duration) (*FileMeta, error) {
+	if err := filesman.WriteFile(filename, data); err != nil {
+		return nil, err
+	}
+	meta := &FileMeta{
+		Type:    fileType,
+		Size:    int64(len(data)),
+		Created: time.Now(),
+	}
+	if old, err := filesman.ReadMeta(filename); err == nil {
+		meta.Created, meta.Expires, meta.LegalHold = old.Created, old.Expires, old.LegalHold
+	}
+	if ttl > 0 {
+		meta.Expires = meta.Created.Add(ttl)
+	}
+	if fileType == PDF_TYPE {
+		meta.Pages = PdfPageCount(data)
+	}
+	return meta, filesman.WriteMeta(filename, meta)
+}
+
+// ExpireTime returns when the file expires, the upload ttl taking precedence
+// over the most specific matching policy. ok is false if it never expires.
+func (filesman *Filesman) ExpireTime(filename string, meta *FileMeta) (expires time.Time, ok bool) {
+	if !meta.Expires.IsZero() {
+		return meta.Expires, true
+	}
+	addr, _ := SplitFilename(filename)
+	best := -1
+	for _, policy := range filesman.Retention {
+		if policy.Addr != "" && !strings.EqualFold(policy.Addr, addr) {
+			continue
+		}
+		if policy.Type != "" && !strings.EqualFold(policy.Type, meta.Type) {
+			continue
+		}
+		score := 0
+		if policy.Addr != "" {
+			score += 2
+		}
+		if policy.Type != "" {
+			score++
+		}
+		if score > best {
+			best = score
+			expires = meta.Created.Add(policy.TTL)
+		}
+	}
+	return expires, best >= 0
+}
+
+// Remove deletes the real filename with its metadata, unless it is on legal
+// hold.
+func (filesman *Filesman) Remove(filename string) error {
+	if meta, err := filesman.ReadMeta(filename); err == nil && meta.LegalHold {
+		return ErrLegalHold
+	}
+	err := os.Remove(filepath.Join(filesman.Filedir, filename))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	sidecars, _ := filepath.Glob(filesman.metaPath(filename, ".*"))
+	for _, sidecar := range sidecars {
+		_ = os.Remove(sidecar)
+	}
+	return nil
+}
+
+// Reap removes expired files and returns their real names.
+func (filesman *Filesman) Reap() []string {
+	var removed []string
+	metas, _ := filepath.Glob(filesman.metaPath("*", ".json"))
+	now := time.Now()
+	for _, metapath := range metas {
+		filename := strings.TrimSuffix(filepath.Base(metapath), ".json")
+		meta, err := filesman.ReadMeta(filename)
+		if err != nil || meta.LegalHold {
+			continue
+		}
+		expires, ok := filesman.ExpireTime(filename, meta)
+		if !ok || expires.After(now) {
+			continue
+		}
+		if filesman.Remove(filename) == nil {
+			removed = append(removed, filename)
+		}
+	}
+	return removed
+}
+
+// isAdmin reports whether the request carries the admin token.
+func (filesman *Filesman) isAdmin(c *gin.Context) bool {
+	token := c.GetHeader("admintoken")
+	return filesman.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(filesman.AdminToken)) == 1
+}
+
+// LegalHold places a file of the caller on legal hold or, with the admin
+// token, lifts it.
+func (filesman *Filesman) LegalHold(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	filename := c.Param("filename")
+
+	filenameReal, err := GenFilename(c, filename)
+	if err != nil {
+		return
+	}
+	hold, err := strconv.ParseBool(c.PostForm("hold"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Params hold error",
+		})
+		return
+	}
+	if !hold && !filesman.isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Lifting a legal hold needs the admin token",
+		})
+		return
+	}
+
+	info, err := filesman.Stat(filenameReal)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "File not found",
+		})
+		return
+	}
+	meta, err := filesman.ReadMeta(filenameReal)
+	if err != nil {
+		// uploaded before metadata was kept
+		meta = &FileMeta{
+			Type:    mime.TypeByExtension(filepath.Ext(filename)),
+			Size:    info.Size(),
+			Created: info.ModTime(),
+		}
+	}
+	meta.LegalHold = hold
+	if err := filesman.WriteMeta(filenameReal, meta); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not write file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "ok",
+		"file":      filename,
+		"legalhold": hold,
+	})
+}
+
+func (filesman *Filesman) Delete(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	filename := c.Param("filename")
+
+	filenameReal, err := GenFilename(c, filename)
+	if err != nil {
+		return
+	}
+	if _, err := filesman.Stat(filenameReal); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "File not found",
+		})
+		return
+	}
+
+	err = filesman.Remove(filenameReal)
+	if err == ErrLegalHold {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "File is under legal hold",
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not delete file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"file":   filename,
+	})
+}
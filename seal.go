@@ -0,0 +1,306 @@
+package filesman
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shellow/keyman"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const SEALDIR = ".seals"
+
+var sealName = regexp.MustCompile(`^[\w.-]{1,64}$`)
+
+// sealLock serializes updates of the seal indexes.
+var sealLock sync.Mutex
+
+// Seal is a stamp image registered under a name by an address. Width and
+// Opacity are the defaults of placements using it, 0 meaning none.
+type Seal struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Width    float64   `json:"width"`
+	Opacity  float64   `json:"opacity"`
+	Disabled bool      `json:"disabled"`
+	Created  time.Time `json:"created"`
+}
+
+// SealError reports a seal that is not registered or disabled.
+type SealError struct {
+	Name string
+}
+
+func (err *SealError) Error() string {
+	return fmt.Sprintf("Seal %q not available", err.Name)
+}
+
+func sealImageName(addr string, name string) string {
+	return filepath.Join(SEALDIR, BuildFilename(addr, name))
+}
+
+func (filesman *Filesman) sealIndexPath(addr string) string {
+	return filepath.Join(filesman.Filedir, SEALDIR, addr+".json")
+}
+
+// Seals returns the seals registered by addr.
+func (filesman *Filesman) Seals(addr string) ([]Seal, error) {
+	b, err := ioutil.ReadFile(filesman.sealIndexPath(addr))
+	if os.IsNotExist(err) {
+		return []Seal{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var seals []Seal
+	err = json.Unmarshal(b, &seals)
+	return seals, err
+}
+
+func (filesman *Filesman) writeSeals(addr string, seals []Seal) error {
+	b, err := json.Marshal(seals)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filesman.sealIndexPath(addr), b, 0644)
+}
+
+// AddSeal registers the seal image for addr, replacing a seal of the same
+// name.
+func (filesman *Filesman) AddSeal(addr string, seal Seal, image []byte) error {
+	sealLock.Lock()
+	defer sealLock.Unlock()
+	if err := os.MkdirAll(filepath.Join(filesman.Filedir, SEALDIR), 0755); err != nil {
+		return err
+	}
+	seals, err := filesman.Seals(addr)
+	if err != nil {
+		return err
+	}
+	if err := filesman.WriteFile(sealImageName(addr, seal.Name), image); err != nil {
+		return err
+	}
+	for i := range seals {
+		if seals[i].Name == seal.Name {
+			seals[i] = seal
+			return filesman.writeSeals(addr, seals)
+		}
+	}
+	return filesman.writeSeals(addr, append(seals, seal))
+}
+
+// SetSealDisabled disables or enables again a seal of addr.
+func (filesman *Filesman) SetSealDisabled(addr string, name string, disabled bool) error {
+	sealLock.Lock()
+	defer sealLock.Unlock()
+	seals, err := filesman.Seals(addr)
+	if err != nil {
+		return err
+	}
+	for i := range seals {
+		if seals[i].Name == name {
+			seals[i].Disabled = disabled
+			return filesman.writeSeals(addr, seals)
+		}
+	}
+	return &SealError{Name: name}
+}
+
+// ReadSeal returns an enabled seal of addr and its image.
+func (filesman *Filesman) ReadSeal(addr string, name string) (*Seal, []byte, error) {
+	seals, err := filesman.Seals(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, seal := range seals {
+		if seal.Name != name {
+			continue
+		}
+		if seal.Disabled {
+			break
+		}
+		image, err := filesman.ReadFile(sealImageName(addr, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &seal, image, nil
+	}
+	return nil, nil, &SealError{Name: name}
+}
+
+// resolveSeals loads the seals the placements of addr refer to into images
+// and fills in the seal defaults.
+func (filesman *Filesman) resolveSeals(addr string, placements []Placement, images map[string][]byte) error {
+	for i := range placements {
+		placement := &placements[i]
+		if placement.Seal == "" {
+			continue
+		}
+		if addr == "" {
+			return &SealError{Name: placement.Seal}
+		}
+		seal, image, err := filesman.ReadSeal(addr, placement.Seal)
+		if err != nil {
+			return err
+		}
+		placement.Image = "seal:" + seal.Name
+		images[placement.Image] = image
+		if placement.Width == 0 {
+			placement.Width = seal.Width
+		}
+		if placement.Opacity == nil && seal.Opacity > 0 {
+			opacity := seal.Opacity
+			placement.Opacity = &opacity
+		}
+	}
+	return nil
+}
+
+func (filesman *Filesman) RegisterSeal(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	if err := c.Request.ParseMultipartForm(filesman.MaxUploadSize); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Could not parse multipart form",
+		})
+		return
+	}
+	addr, err := keyman.TokenToAddrStr(c.GetHeader("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+		return
+	}
+
+	seal := Seal{Name: c.Request.FormValue("name"), Created: time.Now()}
+	if !sealName.MatchString(seal.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Params name error",
+		})
+		return
+	}
+	seal.Width, err = paramFloat(c.Request.FormValue("width"), 100)
+	if err != nil || seal.Width <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Params width error",
+		})
+		return
+	}
+	seal.Opacity, err = paramFloat(c.Request.FormValue("opacity"), 0)
+	if err != nil || seal.Opacity < 0 || seal.Opacity > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Params opacity error",
+		})
+		return
+	}
+
+	image, err := filesman.formFile(c, "image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	seal.Type = http.DetectContentType(image)
+	switch seal.Type {
+	case "image/jpeg", "image/gif", "image/png":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid file type",
+		})
+		return
+	}
+
+	if err := filesman.AddSeal(addr, seal, image); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not write file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"seal":   seal,
+	})
+}
+
+func (filesman *Filesman) ListSeals(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	addr, err := keyman.TokenToAddrStr(c.GetHeader("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+		return
+	}
+	seals, err := filesman.Seals(addr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not read seals",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"seals":  seals,
+	})
+}
+
+func (filesman *Filesman) DisableSeal(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	name := c.Param("name")
+	addr, err := keyman.TokenToAddrStr(c.GetHeader("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+		return
+	}
+	disabled, err := strconv.ParseBool(c.DefaultPostForm("disabled", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Params disabled error",
+		})
+		return
+	}
+
+	if err := filesman.SetSealDisabled(addr, name, disabled); err != nil {
+		if _, ok := err.(*SealError); ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not write file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "ok",
+		"seal":     name,
+		"disabled": disabled,
+	})
+}
@@ -0,0 +1,503 @@
+package filesman
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"github.com/minio/sha256-simd"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"golang.org/x/crypto/pkcs12"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"time"
+)
+
+const (
+	SIGN_RSA = "rsa" // sha256 with RSA
+	SIGN_SM2 = "sm2" // sm3 with SM2
+)
+
+// CMS (RFC 5652) structures for detached signatures, only the parts we need.
+
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertV2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidRSAEncryption        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSM3                  = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401}
+	oidSM2Sign              = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 1}
+	oidSM3WithSM2           = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSHA1WithRSA          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	algorithmSHA256         = pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	algorithmSM3            = pkix.AlgorithmIdentifier{Algorithm: oidSM3}
+	algorithmRSAEncryption  = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	algorithmSM2Signature   = pkix.AlgorithmIdentifier{Algorithm: oidSM2Sign}
+	errUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+)
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	Sid                asn1.RawValue // issuerAndSerial, or a subject key id
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type detachedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo detachedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// essCertIDv2 identifies the signing certificate (RFC 5035), as PAdES
+// requires. HashAlgorithm is left out for the sha256 default.
+type essCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// Signer holds the private key and certificate documents are signed with.
+type Signer struct {
+	Alg    string // SIGN_RSA or SIGN_SM2
+	Name   string // common name of the certificate subject
+	cert   []byte // DER
+	issuer []byte // DER issuer name of cert
+	serial *big.Int
+	rsaKey *rsa.PrivateKey
+	sm2Key *sm2.PrivateKey
+}
+
+// LoadPKCS12Signer reads an RSA key and certificate from a PKCS#12 file.
+// Only the legacy 3DES encryption is supported, with OpenSSL 3 export the
+// file using -legacy.
+func LoadPKCS12Signer(path string, password string) (*Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, cert, err := pkcs12.Decode(data, password)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("pkcs12 key is not RSA")
+	}
+	return &Signer{
+		Alg:    SIGN_RSA,
+		Name:   cert.Subject.CommonName,
+		cert:   cert.Raw,
+		issuer: cert.RawIssuer,
+		serial: cert.SerialNumber,
+		rsaKey: rsaKey,
+	}, nil
+}
+
+// LoadSM2Signer reads an SM2 certificate and private key from PEM files,
+// password decrypts the key when not empty.
+func LoadSM2Signer(certPath string, keyPath string, password string) (*Signer, error) {
+	certPem, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPem, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := smx509.ReadCertificateFromPem(certPem)
+	if err != nil {
+		return nil, err
+	}
+	var pwd []byte
+	if password != "" {
+		pwd = []byte(password)
+	}
+	key, err := smx509.ReadPrivateKeyFromPem(keyPem, pwd)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := sm2PublicKey(cert)
+	if err != nil {
+		return nil, err
+	}
+	if pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+		return nil, errors.New("sm2 key does not match certificate")
+	}
+	return &Signer{
+		Alg:    SIGN_SM2,
+		Name:   cert.Subject.CommonName,
+		cert:   cert.Raw,
+		issuer: cert.RawIssuer,
+		serial: cert.SerialNumber,
+		sm2Key: key,
+	}, nil
+}
+
+// sm2PublicKey returns the SM2 public key of cert, which the gmsm parser
+// leaves as an ecdsa key on the SM2 curve.
+func sm2PublicKey(cert *smx509.Certificate) (*sm2.PublicKey, error) {
+	switch pub := cert.PublicKey.(type) {
+	case *sm2.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve == sm2.P256Sm2() {
+			return &sm2.PublicKey{Curve: pub.Curve, X: pub.X, Y: pub.Y}, nil
+		}
+	}
+	return nil, errors.New("certificate key is not SM2")
+}
+
+// digest returns the digest algorithm of the signer and the digest of data.
+func (signer *Signer) digest(data []byte) (pkix.AlgorithmIdentifier, []byte) {
+	if signer.Alg == SIGN_SM2 {
+		return algorithmSM3, sm3.Sm3Sum(data)
+	}
+	hash := sha256.Sum256(data)
+	return algorithmSHA256, hash[:]
+}
+
+// signedAttributes returns the DER encoded SET of the signed attributes,
+// sorted as DER requires.
+func signedAttributes(attrs []attribute) ([]byte, error) {
+	var encoded [][]byte
+	for _, attr := range attrs {
+		b, err := asn1.Marshal(attr)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+}
+
+// SignDetached returns a DER encoded CMS SignedData over content, without
+// the content. The signed attributes follow CAdES-BES: content type,
+// message digest and signing certificate, the signing time being carried
+// by the PDF signature dictionary.
+func (signer *Signer) SignDetached(content []byte) ([]byte, error) {
+	digestAlg, digest := signer.digest(content)
+	_, certHash := signer.digest(signer.cert)
+	certID := essCertIDv2{CertHash: certHash}
+	if signer.Alg == SIGN_SM2 {
+		certID.HashAlgorithm = algorithmSM3
+	}
+
+	values := []interface{}{oidData, digest, signingCertificateV2{Certs: []essCertIDv2{certID}}}
+	types := []asn1.ObjectIdentifier{oidAttrContentType, oidAttrMessageDigest, oidAttrSigningCertV2}
+	attrs := make([]attribute, len(values))
+	for i, value := range values {
+		b, err := asn1.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[i] = attribute{Type: types[i], Values: []asn1.RawValue{{FullBytes: b}}}
+	}
+	signed, err := signedAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	var signatureAlg pkix.AlgorithmIdentifier
+	switch signer.Alg {
+	case SIGN_RSA:
+		_, hashed := signer.digest(signed)
+		signature, err = rsa.SignPKCS1v15(rand.Reader, signer.rsaKey, crypto.SHA256, hashed)
+		signatureAlg = algorithmRSAEncryption
+	case SIGN_SM2:
+		// sm2 hashes the message itself, with the signer id
+		signature, err = signer.sm2Key.Sign(rand.Reader, signed, nil)
+		signatureAlg = algorithmSM2Signature
+	default:
+		err = errUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the signed attributes are sent [0] IMPLICIT instead of as SET
+	var set asn1.RawValue
+	if _, err := asn1.Unmarshal(signed, &set); err != nil {
+		return nil, err
+	}
+	set.Class, set.Tag, set.FullBytes = asn1.ClassContextSpecific, 0, nil
+	sid, err := asn1.Marshal(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: signer.issuer}, Serial: signer.serial})
+	if err != nil {
+		return nil, err
+	}
+
+	sd, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: detachedContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signer.cert},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			Sid:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    digestAlg,
+			SignedAttrs:        set,
+			SignatureAlgorithm: signatureAlg,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// signatureSize is an upper bound of the SignDetached output size, the
+// space reserved for it in the PDF.
+func (signer *Signer) signatureSize() int {
+	return len(signer.cert) + 2048
+}
+
+// LoadTrustRoots reads the PEM certificates signatures are trusted up to,
+// RSA and SM2 alike.
+func LoadTrustRoots(path string) (*smx509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := smx509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates in " + path)
+	}
+	return roots, nil
+}
+
+// digestFor returns the hash of a digest algorithm and a function computing
+// it, the hash being 0 for sm3.
+func digestFor(oid asn1.ObjectIdentifier) (crypto.Hash, func([]byte) []byte, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, func(data []byte) []byte {
+			sum := sha1.Sum(data)
+			return sum[:]
+		}, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, func(data []byte) []byte {
+			sum := sha256.Sum256(data)
+			return sum[:]
+		}, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, func(data []byte) []byte {
+			sum := sha512.Sum384(data)
+			return sum[:]
+		}, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, func(data []byte) []byte {
+			sum := sha512.Sum512(data)
+			return sum[:]
+		}, nil
+	case oid.Equal(oidSM3):
+		return 0, sm3.Sm3Sum, nil
+	}
+	return 0, nil, errUnsupportedAlgorithm
+}
+
+// signatureAlg returns SIGN_RSA or SIGN_SM2 for a signature algorithm.
+func signatureAlg(oid asn1.ObjectIdentifier) string {
+	switch {
+	case oid.Equal(oidRSAEncryption), oid.Equal(oidSHA1WithRSA), oid.Equal(oidSHA256WithRSA),
+		oid.Equal(oidSHA384WithRSA), oid.Equal(oidSHA512WithRSA):
+		return SIGN_RSA
+	case oid.Equal(oidSM2Sign), oid.Equal(oidSM3WithSM2):
+		return SIGN_SM2
+	}
+	return ""
+}
+
+// signerCert finds the certificate identified by sid.
+func signerCert(sid asn1.RawValue, certs []*smx509.Certificate) *smx509.Certificate {
+	var ias issuerAndSerial
+	if rest, err := asn1.Unmarshal(sid.FullBytes, &ias); err == nil && len(rest) == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+				return cert
+			}
+		}
+		return nil
+	}
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert
+			}
+		}
+	}
+	return nil
+}
+
+// messageDigest returns the message digest of the signed attributes.
+func messageDigest(attrs []byte) ([]byte, error) {
+	for rest := attrs; len(rest) > 0; {
+		var attr attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return nil, err
+		}
+		if attr.Type.Equal(oidAttrMessageDigest) && len(attr.Values) == 1 {
+			var digest []byte
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &digest)
+			return digest, err
+		}
+	}
+	return nil, errors.New("message digest missing")
+}
+
+// SignatureInfo describes the signer of a CMS signature.
+type SignatureInfo struct {
+	Alg    string // SIGN_RSA or SIGN_SM2
+	Cert   *smx509.Certificate
+	Certs  []*smx509.Certificate // all certificates carried, Cert included
+	Intact bool                  // content digest and signature match
+}
+
+// VerifyDetached checks a DER encoded CMS SignedData over the detached
+// content. The error tells why the signature is not intact, info is set as
+// far as the signature could be decoded. Trust is checked by VerifyChain.
+func VerifyDetached(signature []byte, content []byte) (*SignatureInfo, error) {
+	info := &SignatureInfo{}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(signature, &ci); err != nil {
+		return info, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return info, errors.New("not a cms signed data")
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return info, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return info, errors.New("expected a single signer")
+	}
+	certs, err := smx509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return info, err
+	}
+	si := sd.SignerInfos[0]
+	info.Certs = certs
+	info.Alg = signatureAlg(si.SignatureAlgorithm.Algorithm)
+	info.Cert = signerCert(si.Sid, certs)
+	if info.Cert == nil {
+		return info, errors.New("signer certificate not found")
+	}
+
+	hash, sum, err := digestFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return info, err
+	}
+	// without signed attributes the content itself is signed
+	msg := content
+	if len(si.SignedAttrs.Bytes) > 0 {
+		digest, err := messageDigest(si.SignedAttrs.Bytes)
+		if err != nil {
+			return info, err
+		}
+		if !bytes.Equal(digest, sum(content)) {
+			return info, errors.New("content digest mismatch")
+		}
+		msg, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+		if err != nil {
+			return info, err
+		}
+	}
+
+	switch info.Alg {
+	case SIGN_RSA:
+		pub, ok := info.Cert.PublicKey.(*rsa.PublicKey)
+		if !ok || hash == 0 {
+			return info, errUnsupportedAlgorithm
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, sum(msg), si.Signature); err != nil {
+			return info, errors.New("signature mismatch")
+		}
+	case SIGN_SM2:
+		pub, err := sm2PublicKey(info.Cert)
+		if err != nil {
+			return info, err
+		}
+		if !pub.Verify(msg, si.Signature) {
+			return info, errors.New("signature mismatch")
+		}
+	default:
+		return info, errUnsupportedAlgorithm
+	}
+	info.Intact = true
+	return info, nil
+}
+
+// VerifyChain checks that the signer certificate chains up to roots at the
+// given time, the other certificates of the signature serving as
+// intermediates.
+func (info *SignatureInfo) VerifyChain(roots *smx509.CertPool, at time.Time) error {
+	if roots == nil {
+		return errors.New("no trust roots configured")
+	}
+	if info.Cert == nil {
+		return errors.New("signer certificate not found")
+	}
+	intermediates := smx509.NewCertPool()
+	for _, cert := range info.Certs {
+		if cert != info.Cert {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := info.Cert.Verify(smx509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny},
+	})
+	return err
+}
@@ -0,0 +1,141 @@
+package filesman
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate issues a certificate of the subject and public key pub,
+// signed with key of the issuer, self-signed when issuer is nil. SM2 keys
+// go through gmsm, which only issues certificates of SM2 keys.
+func testCertificate(t *testing.T, subject string, pub interface{}, issuer *smx509.Certificate, key interface{}) *smx509.Certificate {
+	ca := issuer == nil
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore, notAfter := time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+
+	var der []byte
+	switch pub := pub.(type) {
+	case *sm2.PublicKey:
+		template := &smx509.Certificate{
+			SerialNumber:          serial,
+			Subject:               pkix.Name{CommonName: subject},
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			SignatureAlgorithm:    smx509.SM2WithSM3,
+			KeyUsage:              smx509.KeyUsageDigitalSignature | smx509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  ca,
+		}
+		parent := issuer
+		if ca {
+			parent = template
+		}
+		der, err = smx509.CreateCertificate(template, parent, pub, key.(*sm2.PrivateKey))
+	case *rsa.PublicKey:
+		template := &x509.Certificate{
+			SerialNumber:          serial,
+			Subject:               pkix.Name{CommonName: subject},
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  ca,
+		}
+		parent := template
+		if !ca {
+			parent, err = x509.ParseCertificate(issuer.Raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		der, err = x509.CreateCertificate(rand.Reader, template, parent, pub, key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := smx509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testSigner returns a signer of alg with a certificate issued by a new
+// root, and a pool of that root.
+func testSigner(t *testing.T, alg string) (*Signer, *smx509.CertPool) {
+	var rootPub, rootKey, pub interface{}
+	signer := &Signer{Alg: alg, Name: "Test Signer"}
+	switch alg {
+	case SIGN_SM2:
+		key, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rootPub, rootKey = &key.PublicKey, key
+		signer.sm2Key, err = sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub = &signer.sm2Key.PublicKey
+	case SIGN_RSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rootPub, rootKey = &key.PublicKey, key
+		signer.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub = &signer.rsaKey.PublicKey
+	}
+	root := testCertificate(t, "Test Root", rootPub, nil, rootKey)
+	cert := testCertificate(t, signer.Name, pub, root, rootKey)
+	signer.cert, signer.issuer, signer.serial = cert.Raw, cert.RawIssuer, cert.SerialNumber
+
+	roots := smx509.NewCertPool()
+	roots.AddCert(root)
+	return signer, roots
+}
+
+func TestSignDetached(t *testing.T) {
+	content := []byte("signed content")
+	for _, alg := range []string{SIGN_RSA, SIGN_SM2} {
+		signer, roots := testSigner(t, alg)
+		_, otherRoots := testSigner(t, alg)
+		signature, err := signer.SignDetached(content)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if len(signature) > signer.signatureSize() {
+			t.Errorf("%s: signature of %d bytes exceeds %d", alg, len(signature), signer.signatureSize())
+		}
+
+		info, err := VerifyDetached(signature, content)
+		if err != nil || !info.Intact || info.Alg != alg || info.Cert.Subject.CommonName != signer.Name {
+			t.Errorf("%s: %+v, %v", alg, info, err)
+		}
+		if err := info.VerifyChain(roots, time.Now()); err != nil {
+			t.Errorf("%s: chain: %v", alg, err)
+		}
+		if err := info.VerifyChain(otherRoots, time.Now()); err == nil {
+			t.Errorf("%s: chain to other root accepted", alg)
+		}
+
+		changed := append([]byte{}, content...)
+		changed[0] ^= 1
+		if info, err := VerifyDetached(signature, changed); err == nil || info.Intact {
+			t.Errorf("%s: changed content accepted", alg)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package filesman
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	SPLIT_PAGES     = "pages"     // extract the selected pages into one pdf
+	SPLIT_EVERY     = "every"     // a pdf of every N pages
+	SPLIT_BOOKMARKS = "bookmarks" // a pdf per top level bookmark
+)
+
+const MAX_SPLIT_PARTS = 1000
+
+var (
+	errNoBookmarks   = errors.New("No bookmarks")
+	errTooManyParts  = errors.New("Too many parts")
+	errSplitMode     = errors.New("invalid split mode")
+	errSplitPageSize = errors.New("invalid pages per part")
+)
+
+// SplitPart is one pdf cut out by SplitPdf.
+type SplitPart struct {
+	Title string `json:"title,omitempty"` // of the bookmark the part starts at
+	Pages []int  `json:"pages"`
+	File  string `json:"file"` // set once stored
+	Data  []byte `json:"-"`
+}
+
+// extractPages returns a new pdf of the pages, in order.
+func extractPages(pdfReader *pdf.PdfReader, pages []int) ([]byte, error) {
+	c := creator.New()
+	for _, n := range pages {
+		page, err := pdfReader.GetPage(n)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.AddPage(page); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// splitEvery returns the page groups of every n pages.
+func splitEvery(numPages int, n int) []SplitPart {
+	var parts []SplitPart
+	for first := 1; first <= numPages; first += n {
+		var part SplitPart
+		for i := first; i < first+n && i <= numPages; i++ {
+			part.Pages = append(part.Pages, i)
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// splitBookmarks returns the page groups starting at the top level
+// bookmarks, up to the next one. Pages before the first bookmark make a
+// part of their own.
+func splitBookmarks(pdfReader *pdf.PdfReader, numPages int) ([]SplitPart, error) {
+	outline, err := pdfReader.GetOutlines()
+	if err != nil {
+		return nil, err
+	}
+	type start struct {
+		page  int
+		title string
+	}
+	var starts []start
+	if outline != nil {
+		for _, item := range outline.Entries {
+			page := int(item.Dest.Page) + 1
+			if page < 1 || page > numPages {
+				continue
+			}
+			starts = append(starts, start{page, item.Title})
+		}
+	}
+	if len(starts) == 0 {
+		return nil, errNoBookmarks
+	}
+	sort.SliceStable(starts, func(i, j int) bool {
+		return starts[i].page < starts[j].page
+	})
+	if starts[0].page > 1 {
+		starts = append([]start{{page: 1}}, starts...)
+	}
+
+	var parts []SplitPart
+	for i, s := range starts {
+		last := numPages
+		if i+1 < len(starts) {
+			last = starts[i+1].page - 1
+		}
+		// bookmarks on the same page share it with the last of them
+		if last < s.page {
+			continue
+		}
+		part := SplitPart{Title: s.title}
+		for n := s.page; n <= last; n++ {
+			part.Pages = append(part.Pages, n)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// SplitPdf cuts the pdf as mode says: SPLIT_PAGES takes the pages of sel,
+// SPLIT_EVERY groups every n pages and SPLIT_BOOKMARKS starts a part at
+// each top level bookmark.
+func SplitPdf(pdfData []byte, mode string, sel PageSelector, n int) ([]SplitPart, error) {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []SplitPart
+	switch mode {
+	case SPLIT_PAGES:
+		pages, err := sel.Pages(numPages)
+		if err != nil {
+			return nil, err
+		}
+		parts = []SplitPart{{Pages: pages}}
+	case SPLIT_EVERY:
+		if n < 1 {
+			return nil, errSplitPageSize
+		}
+		parts = splitEvery(numPages, n)
+	case SPLIT_BOOKMARKS:
+		parts, err = splitBookmarks(pdfReader, numPages)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errSplitMode
+	}
+	if len(parts) > MAX_SPLIT_PARTS {
+		return nil, errTooManyParts
+	}
+
+	for i := range parts {
+		parts[i].Data, err = extractPages(pdfReader, parts[i].Pages)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// Split cuts a stored pdf into new stored pdfs, see SplitPdf. The mode
+// parameter defaults to SPLIT_PAGES, which takes the pages parameter,
+// SPLIT_EVERY takes n.
+func (filesman *Filesman) Split(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	pdffile, err := GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	var sel PageSelector
+	var n int
+	mode := c.DefaultPostForm("mode", SPLIT_PAGES)
+	switch mode {
+	case SPLIT_PAGES:
+		sel, err = ParsePageSelector(c.PostForm("pages"))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params pages error",
+			})
+			return
+		}
+	case SPLIT_EVERY:
+		n, err = strconv.Atoi(c.PostForm("n"))
+		if err != nil || n < 1 {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params n error",
+			})
+			return
+		}
+	case SPLIT_BOOKMARKS:
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params mode error",
+		})
+		return
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	parts, err := SplitPdf(pdfData, mode, sel, n)
+	if err != nil {
+		msg := stampErrorMessage(err, "Split error")
+		if err == errNoBookmarks || err == errTooManyParts {
+			msg = err.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": msg,
+		})
+		return
+	}
+	for i := range parts {
+		parts[i].File, err = filesman.storePdf(c, parts[i].Data)
+		if err != nil {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "ok",
+		"resultfiles": parts,
+	})
+}
@@ -0,0 +1,350 @@
+package filesman
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/unidoc/unipdf/core/security"
+	"github.com/unidoc/unipdf/creator"
+	"strconv"
+)
+
+const (
+	STAMP_IMAGE       = "image"
+	STAMP_TEXT        = "text"
+	STAMP_PERFORATION = "perforation"
+	STAMP_QR          = "qr"
+)
+
+// Placement puts an image, a line of text or a QR code on the pages selected
+// by Page. Image refers to a stored file in ImgAddPdf and to a form file
+// field in ImgAddPdfOnce, Seal to a seal registered by the caller instead.
+// Text may use the variables expanded by stampText, for a QR placement it is
+// the payload, see qrText, and Width the size of the code. A perforation
+// placement slices the image across the selected pages, see
+// newPerforationStamp. Setting Unit or Origin measures Xpos, Ypos and Width
+// on the page as displayed, see pageFrame, instead of in plain creator
+// points from the upper left corner of the media box. An anchored placement
+// is always laid out on the page as displayed, with Origin taken in the box
+// of the Anchor text found on the selected pages instead of the page, see
+// layoutIn.
+type Placement struct {
+	Type     string       `json:"type"` // STAMP_IMAGE when empty
+	Image    string       `json:"image"`
+	Seal     string       `json:"seal"` // Width and Opacity default to the seal's
+	Text     string       `json:"text"`
+	Font     string       `json:"font"`
+	FontSize float64      `json:"fontsize"`
+	Color    string       `json:"color"` // "#rrggbb"
+	Page     PageSelector `json:"page"`
+	Xpos     float64      `json:"xpos"`
+	Ypos     float64      `json:"ypos"`
+	Width    float64      `json:"width"`
+	Rotation float64      `json:"rotation"` // degrees counter-clockwise
+	Opacity  *float64     `json:"opacity"`  // 0 to 1, opaque when unset
+	Unit     string       `json:"unit"`     // UNIT_PT when empty
+	Origin   string       `json:"origin"`   // ORIGIN_TOP_LEFT when empty
+
+	Anchor      string `json:"anchor"`
+	AnchorMatch string `json:"anchormatch"` // ANCHOR_FIRST when empty, ANCHOR_LAST or ANCHOR_EACH
+}
+
+func (placement *Placement) valid() bool {
+	if placement.Page.IsZero() {
+		return false
+	}
+	if placement.Opacity != nil && (*placement.Opacity < 0 || *placement.Opacity > 1) {
+		return false
+	}
+	if !validUnit(placement.Unit) || !validOrigin(placement.Origin) {
+		return false
+	}
+	switch placement.AnchorMatch {
+	case "", ANCHOR_FIRST, ANCHOR_LAST, ANCHOR_EACH:
+	default:
+		return false
+	}
+	if placement.Anchor != "" && placement.Type == STAMP_PERFORATION {
+		return false
+	}
+	switch placement.Type {
+	case "", STAMP_IMAGE, STAMP_PERFORATION:
+		if placement.Seal != "" {
+			return placement.Image == "" && placement.Width >= 0
+		}
+		return placement.Image != "" && placement.Width > 0
+	case STAMP_TEXT:
+		return placement.Text != ""
+	case STAMP_QR:
+		return placement.Image == "" && placement.Seal == "" && placement.Width > 0
+	}
+	return false
+}
+
+// ImageRefs returns the distinct images used by the placements.
+func ImageRefs(placements []Placement) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	for _, placement := range placements {
+		if placement.Type == STAMP_TEXT || placement.Type == STAMP_QR || placement.Seal != "" || seen[placement.Image] {
+			continue
+		}
+		seen[placement.Image] = true
+		refs = append(refs, placement.Image)
+	}
+	return refs
+}
+
+// ParsePlacements reads the JSON "placements" parameter, or else builds a
+// single placement of image, or of the seal parameter, from the page, xpos,
+// ypos and width parameters.
+func ParsePlacements(param func(string) string, image string) ([]Placement, error) {
+	if s := param("placements"); s != "" {
+		var placements []Placement
+		if err := json.Unmarshal([]byte(s), &placements); err != nil || len(placements) == 0 {
+			return nil, errors.New("Params placements error")
+		}
+		for i := range placements {
+			if placements[i].Anchor != "" && placements[i].Page.IsZero() {
+				// anchors are searched on all pages by default
+				placements[i].Page, _ = ParsePageSelector("all")
+			}
+			if !placements[i].valid() {
+				return nil, errors.New("Params placements error")
+			}
+		}
+		return placements, nil
+	}
+
+	page, err := ParsePageSelector(param("page"))
+	if err != nil {
+		return nil, errors.New("Params page error")
+	}
+	seal := param("seal")
+	if image == "" && seal == "" {
+		return nil, errors.New("Params image error")
+	}
+	xpos, err := strconv.ParseFloat(param("xpos"), 64)
+	if err != nil {
+		return nil, errors.New("Params xpos error")
+	}
+	ypos, err := strconv.ParseFloat(param("ypos"), 64)
+	if err != nil {
+		return nil, errors.New("Params ypos error")
+	}
+	if seal != "" {
+		// the seal has a default width
+		width, err := paramFloat(param("width"), 0)
+		if err != nil || width < 0 {
+			return nil, errors.New("Params width error")
+		}
+		return []Placement{{Seal: seal, Page: page, Xpos: xpos, Ypos: ypos, Width: width}}, nil
+	}
+	width, err := strconv.ParseFloat(param("width"), 64)
+	if err != nil {
+		return nil, errors.New("Params width error")
+	}
+	return []Placement{{Image: image, Page: page, Xpos: xpos, Ypos: ypos, Width: width}}, nil
+}
+
+// StampCreator applies all placements to the pdf in a single pass over its
+// pages and returns the creator to write the result with. images maps the
+// Image of each placement to the image content.
+func StampCreator(pdfData []byte, placements []Placement, images map[string][]byte, opts StampOptions) (*creator.Creator, error) {
+	c := creator.New()
+	sha256sum, sm3sum := sourceHashes(pdfData)
+
+	pdfReader, _, err := openPdf(pdfData, opts.Password, security.PermModify)
+	if err != nil {
+		return nil, err
+	}
+
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the page selectors, failing on pages out of range.
+	selected := make([]map[int]bool, len(placements))
+	selectedPages := make([][]int, len(placements))
+	for i, placement := range placements {
+		pages, err := placement.Page.Pages(numPages)
+		if err != nil {
+			return nil, err
+		}
+		selectedPages[i] = pages
+		selected[i] = make(map[int]bool)
+		for _, n := range pages {
+			selected[i][n] = true
+		}
+	}
+
+	anchors, err := anchorPositions(pdfReader, placements, selectedPages)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare the stamps, text and QR codes are rendered per page.
+	stamps := make([]func(page int, numPages int) creator.Drawable, len(placements))
+	for i, placement := range placements {
+		if placement.Type == STAMP_TEXT {
+			stamp, err := newTextStamp(c, placement, opts, sha256sum, sm3sum)
+			if err != nil {
+				return nil, err
+			}
+			stamps[i] = stamp
+			continue
+		}
+		if placement.Type == STAMP_QR {
+			stamp, err := newQRStamp(c, placement, opts, sha256sum, sm3sum, selectedPages[i], numPages)
+			if err != nil {
+				return nil, err
+			}
+			stamps[i] = stamp
+			continue
+		}
+
+		imgData, ok := images[placement.Image]
+		if !ok {
+			return nil, fmt.Errorf("image %s not found", placement.Image)
+		}
+		if placement.Type == STAMP_PERFORATION {
+			stamp, err := newPerforationStamp(c, placement, imgData, selectedPages[i])
+			if err != nil {
+				return nil, err
+			}
+			stamps[i] = stamp
+			continue
+		}
+
+		img, err := c.NewImageFromData(imgData)
+		if err != nil {
+			return nil, err
+		}
+		img.ScaleToWidth(placement.Width)
+		img.SetPos(placement.Xpos, placement.Ypos)
+		if placement.Rotation != 0 {
+			img.SetAngle(placement.Rotation)
+		}
+		if placement.Opacity != nil {
+			img.SetOpacity(*placement.Opacity)
+		}
+		stamps[i] = func(int, int) creator.Drawable {
+			return img
+		}
+	}
+
+	// Load the pages.
+	for i := 0; i < numPages; i++ {
+		page, err := pdfReader.GetPage(i + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Add the page.
+		err = c.AddPage(page)
+		if err != nil {
+			return nil, err
+		}
+
+		frame, err := newPageFrame(page)
+		if err != nil {
+			return nil, err
+		}
+
+		// Apply the stamps placed on this page.
+		for j, placement := range placements {
+			if !selected[j][i+1] {
+				continue
+			}
+			d := stamps[j](i+1, numPages)
+			if placement.Type == STAMP_PERFORATION {
+				if strip := d.(*creator.Image); placement.usesLayout() {
+					// each strip is drawn once, at its share of Width
+					strip.ScaleToWidth(toPoints(strip.Width(), placement.Unit, frame.width))
+					x, y, angle := frame.perforationLayout(&placement, strip.Width(), strip.Height())
+					strip.SetAngle(angle)
+					strip.SetPos(x, y)
+				}
+				if err := c.Draw(d); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			p := d.(placeable)
+			if img, ok := d.(*creator.Image); ok && placement.Unit != "" {
+				img.ScaleToWidth(toPoints(placement.Width, placement.Unit, frame.width))
+			}
+
+			var positions [][2]float64
+			if anchors[j] != nil {
+				for _, box := range anchors[j][i+1] {
+					x, y, angle := frame.layoutIn(&placement, box, p.Width(), p.Height())
+					p.SetAngle(angle)
+					positions = append(positions, [2]float64{x, y})
+				}
+			} else if placement.usesLayout() {
+				x, y, angle := frame.layout(&placement, p.Width(), p.Height())
+				p.SetAngle(angle)
+				positions = append(positions, [2]float64{x, y})
+			} else {
+				positions = append(positions, [2]float64{placement.Xpos, placement.Ypos})
+			}
+			draw := func(target drawer) error {
+				for _, pos := range positions {
+					p.SetPos(pos[0], pos[1])
+					if err := target.Draw(p); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if placement.Type == STAMP_TEXT && placement.Opacity != nil {
+				ctx := c.Context()
+				var text *creator.Block
+				text, err = translucent(ctx.PageWidth, ctx.PageHeight, *placement.Opacity, func(blk *creator.Block) error {
+					return draw(blk)
+				})
+				if err == nil {
+					err = c.Draw(text)
+				}
+			} else {
+				err = draw(c)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// StampPdf returns the pdf with all placements applied, see StampCreator.
+func StampPdf(pdfData []byte, placements []Placement, images map[string][]byte, opts StampOptions) ([]byte, error) {
+	c, err := StampCreator(pdfData, placements, images, opts)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	err = c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// stampErrorMessage returns the message for a stamping error. Errors caused
+// by the request are shown as they are, others as msg.
+func stampErrorMessage(err error, msg string) string {
+	if err == errPdfPassword || err == errPdfPermission || err == errWatermarkTiles {
+		return err.Error()
+	}
+	switch err.(type) {
+	case *PageRangeError, *AnchorError, *SealError, *PageEditError:
+		return err.Error()
+	}
+	return msg
+}
@@ -0,0 +1,220 @@
+package filesman
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/tjfoc/gmsm/sm4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	CIPHER_NONE = ""
+	CIPHER_SM4  = "sm4"
+	CIPHER_AES  = "aes"
+)
+
+// Encrypted files start with encMagic, one byte naming the cipher, the
+// length-prefixed data key sealed with the master key and then the content
+// sealed with the data key.
+var encMagic = []byte("FMENC1")
+
+const (
+	encSM4 byte = 1
+	encAES byte = 2
+)
+
+// LoadMasterKey decodes a hex master key, or reads it from a file when key is
+// prefixed with "@".
+func LoadMasterKey(key string) ([]byte, error) {
+	if strings.HasPrefix(key, "@") {
+		b, err := ioutil.ReadFile(key[1:])
+		if err != nil {
+			return nil, err
+		}
+		key = string(b)
+	}
+	return hex.DecodeString(strings.TrimSpace(key))
+}
+
+func newGCM(alg byte, key []byte) (cipher.AEAD, error) {
+	var block cipher.Block
+	var err error
+	switch alg {
+	case encSM4:
+		if len(key) != 16 {
+			return nil, errors.New("sm4 key must be 16 bytes")
+		}
+		block, err = sm4.NewCipher(key)
+	case encAES:
+		if len(key) != 32 {
+			return nil, errors.New("aes key must be 32 bytes")
+		}
+		block, err = aes.NewCipher(key)
+	default:
+		return nil, errors.New("unknown cipher")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func unseal(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// EncryptData seals data with a fresh data key wrapped by masterKey.
+func EncryptData(alg string, masterKey []byte, data []byte) ([]byte, error) {
+	var id byte
+	var keylen int
+	switch alg {
+	case CIPHER_SM4:
+		id, keylen = encSM4, 16
+	case CIPHER_AES:
+		id, keylen = encAES, 32
+	default:
+		return nil, errors.New("unknown cipher " + alg)
+	}
+
+	master, err := newGCM(id, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, keylen)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(master, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(id, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	content, err := seal(aead, data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(encMagic)
+	buf.WriteByte(id)
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(wrapped)))
+	buf.Write(wrapped)
+	buf.Write(content)
+	return buf.Bytes(), nil
+}
+
+// IsEncrypted reports whether data was written by EncryptData.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encMagic)
+}
+
+// DecryptData opens data written by EncryptData.
+func DecryptData(masterKey []byte, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("data not encrypted")
+	}
+	data = data[len(encMagic):]
+	if len(data) < 3 {
+		return nil, errors.New("ciphertext too short")
+	}
+	id := data[0]
+	wlen := int(binary.BigEndian.Uint16(data[1:3]))
+	data = data[3:]
+	if len(data) < wlen {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	master, err := newGCM(id, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := unseal(master, data[:wlen])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(id, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(aead, data[wlen:])
+}
+
+// WriteFile stores data under the real filename, compressing it when its type
+// is listed in CompressTypes and encrypting it when a cipher is configured.
+func (filesman *Filesman) WriteFile(filename string, data []byte) error {
+	var err error
+	if filesman.shouldCompress(http.DetectContentType(data)) {
+		data, err = Compress(data)
+		if err != nil {
+			return err
+		}
+	}
+	if filesman.Cipher != CIPHER_NONE {
+		data, err = EncryptData(filesman.Cipher, filesman.MasterKey, data)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(filesman.Filedir, filename), data, 0644)
+}
+
+// ReadFile returns the original content of the real filename. Files stored
+// before encryption or compression was enabled are returned as is.
+func (filesman *Filesman) ReadFile(filename string) ([]byte, error) {
+	data, encoding, err := filesman.ReadFileEncoded(filename)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == ENCODING_GZIP {
+		return Decompress(data)
+	}
+	return data, nil
+}
+
+// ReadFileEncoded decrypts the real filename but leaves it compressed, the
+// returned encoding is ENCODING_GZIP or empty.
+func (filesman *Filesman) ReadFileEncoded(filename string) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(filesman.Filedir, filename))
+	if err != nil {
+		return nil, "", err
+	}
+	if IsEncrypted(data) {
+		data, err = DecryptData(filesman.MasterKey, data)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if IsCompressed(data) {
+		return data, ENCODING_GZIP, nil
+	}
+	return data, "", nil
+}
+
+// Stat returns the file info of the real filename.
+func (filesman *Filesman) Stat(filename string) (os.FileInfo, error) {
+	return os.Stat(filepath.Join(filesman.Filedir, filename))
+}
@@ -0,0 +1,113 @@
+package filesman
+
+import (
+	"fmt"
+	"github.com/minio/sha256-simd"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StampOptions carries what dynamic stamps need besides the placements.
+type StampOptions struct {
+	Addr      string    // signer address
+	Time      time.Time // upload time of the source file
+	FontDir   string    // TrueType fonts usable by name, e.g. for CJK text
+	Password  string    // of an encrypted source pdf granting modify, the result is not encrypted
+	VerifyURL string    // payload of QR placements without text, see qrText
+}
+
+// stampText expands the variables of a text stamp: {addr}, {time}, {date},
+// {sha256} and {sm3} of the source file, {page} and {pages}.
+func stampText(text string, opts StampOptions, sha256sum string, sm3sum string, page int, numPages int) string {
+	return strings.NewReplacer(
+		"{addr}", opts.Addr,
+		"{time}", opts.Time.Format("2006-01-02 15:04:05"),
+		"{date}", opts.Time.Format("2006-01-02"),
+		"{sha256}", sha256sum,
+		"{sm3}", sm3sum,
+		"{page}", strconv.Itoa(page),
+		"{pages}", strconv.Itoa(numPages),
+	).Replace(text)
+}
+
+func sourceHashes(data []byte) (string, string) {
+	return fmt.Sprintf("%x", sha256.Sum256(data)), fmt.Sprintf("%x", sm3.Sm3Sum(data))
+}
+
+// loadFont returns the TrueType font fontdir/name.ttf when present, or else
+// the standard 14 font of that name. Helvetica is the default.
+func loadFont(fontdir string, name string) (*pdf.PdfFont, error) {
+	if name == "" {
+		name = "Helvetica"
+	}
+	if filepath.Base(name) != name {
+		return nil, fmt.Errorf("invalid font %s", name)
+	}
+	if fontdir != "" {
+		ttf := filepath.Join(fontdir, name+".ttf")
+		if _, err := os.Stat(ttf); err == nil {
+			return pdf.NewCompositePdfFontFromTTFFile(ttf)
+		}
+	}
+	return pdf.NewStandard14Font(pdf.StdFontName(name))
+}
+
+// parseColor parses "#rrggbb" into components between 0 and 1, black when
+// empty.
+func parseColor(color string) (r, g, b float64, err error) {
+	if color == "" {
+		return 0, 0, 0, nil
+	}
+	hex := strings.TrimPrefix(color, "#")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid color %s", color)
+	}
+	return float64(v>>16&0xff) / 255, float64(v>>8&0xff) / 255, float64(v&0xff) / 255, nil
+}
+
+// textColor returns the text color. Translucent text is drawn by
+// translucent, paragraphs having no opacity of their own.
+func textColor(color string) (creator.Color, error) {
+	r, g, b, err := parseColor(color)
+	if err != nil {
+		return nil, err
+	}
+	return creator.ColorRGBFromArithmetic(r, g, b), nil
+}
+
+// newTextStamp returns a function building the paragraph of a text
+// placement for each page, which StampPdf draws translucent.
+func newTextStamp(c *creator.Creator, placement Placement, opts StampOptions, sha256sum string, sm3sum string) (func(page int, numPages int) creator.Drawable, error) {
+	font, err := loadFont(opts.FontDir, placement.Font)
+	if err != nil {
+		return nil, err
+	}
+	color, err := textColor(placement.Color)
+	if err != nil {
+		return nil, err
+	}
+	fontsize := placement.FontSize
+	if fontsize <= 0 {
+		fontsize = 12
+	}
+
+	return func(page int, numPages int) creator.Drawable {
+		p := c.NewParagraph(stampText(placement.Text, opts, sha256sum, sm3sum, page, numPages))
+		p.SetFont(font)
+		p.SetFontSize(fontsize)
+		p.SetColor(color)
+		p.SetEnableWrap(false)
+		p.SetPos(placement.Xpos, placement.Ypos)
+		if placement.Rotation != 0 {
+			p.SetAngle(placement.Rotation)
+		}
+		return p
+	}, nil
+}
@@ -0,0 +1,228 @@
+package filesman
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/minio/sha256-simd"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RFC 3161 time-stamp protocol structures, only the parts we need.
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapContentInfo
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional,default:false"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// TimestampInfo is the decoded content of a time-stamp token.
+type TimestampInfo struct {
+	GenTime       time.Time
+	SerialNumber  string
+	HashedMessage string
+}
+
+// RequestTimestamp asks the TSA at tsaurl for a time-stamp token over the
+// sha256 of data and returns the DER encoded token.
+func RequestTimestamp(tsaurl string, data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: hash[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(tsaurl, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tsa bad status: %s", res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp timeStampResp
+	if _, err := asn1.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	// 0 granted, 1 grantedWithMods
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("tsa rejected request: status %d %v", resp.Status.Status, resp.Status.StatusString)
+	}
+	token := resp.TimeStampToken.FullBytes
+	tst, err := parseTSTInfo(token)
+	if err != nil {
+		return nil, err
+	}
+	// the token must answer this request
+	if tst.Nonce == nil || tst.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("tsa token nonce mismatch")
+	}
+	if !tst.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(tst.MessageImprint.HashedMessage, hash[:]) {
+		return nil, errors.New("tsa token hash mismatch")
+	}
+	return token, nil
+}
+
+// parseTSTInfo decodes the TSTInfo of a DER encoded time-stamp token.
+func parseTSTInfo(token []byte) (*tstInfo, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, err
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &tst); err != nil {
+		return nil, err
+	}
+	return &tst, nil
+}
+
+// ParseTimestampToken decodes the TSTInfo of a DER encoded time-stamp token.
+// The token signature is not verified.
+func ParseTimestampToken(token []byte) (*TimestampInfo, error) {
+	tst, err := parseTSTInfo(token)
+	if err != nil {
+		return nil, err
+	}
+	return &TimestampInfo{
+		GenTime:       tst.GenTime,
+		SerialNumber:  tst.SerialNumber.String(),
+		HashedMessage: fmt.Sprintf("%x", tst.MessageImprint.HashedMessage),
+	}, nil
+}
+
+func (filesman *Filesman) metaPath(filename string, ext string) string {
+	return filepath.Join(filesman.Filedir, ".meta", filename+ext)
+}
+
+// StoreTimestamp requests a token for data and stores it next to filename.
+func (filesman *Filesman) StoreTimestamp(filename string, data []byte) error {
+	token, err := RequestTimestamp(filesman.TsaURL, data)
+	if err != nil {
+		return err
+	}
+	tsrpath := filesman.metaPath(filename, ".tsr")
+	if err := os.MkdirAll(filepath.Dir(tsrpath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(tsrpath, token, 0644)
+}
+
+func (filesman *Filesman) Timestamp(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	filename := c.Param("filename")
+
+	filenameReal, err := GenFilename(c, filename)
+	if err != nil {
+		return
+	}
+
+	token, err := ioutil.ReadFile(filesman.metaPath(filenameReal, ".tsr"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "No timestamp",
+		})
+		return
+	}
+	info, err := ParseTimestampToken(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Invalid timestamp",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"file":    filename,
+		"gentime": info.GenTime,
+		"serial":  info.SerialNumber,
+		"hash":    info.HashedMessage,
+		"token":   base64.StdEncoding.EncodeToString(token),
+	})
+}
@@ -0,0 +1,155 @@
+package filesman
+
+import (
+	"encoding/asn1"
+	"github.com/minio/sha256-simd"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testTSTInfo is a TSTInfo with a TSA name after the nonce, as real TSAs
+// send it.
+type testTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+	TSA            asn1.RawValue
+}
+
+type testEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo testEncapContentInfo
+}
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// testTimestampResp returns a granted response with a token of the imprint
+// and nonce, unsigned as ParseTimestampToken does not check signatures.
+func testTimestampResp(t *testing.T, imprint messageImprint, nonce *big.Int) []byte {
+	tst, err := asn1.Marshal(testTSTInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(42),
+		GenTime:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Nonce:          nonce,
+		TSA:            asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: []byte{0x30, 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := asn1.Marshal(testSignedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		EncapContentInfo: testEncapContentInfo{
+			EContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4},
+			EContent:     tst,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := asn1.Marshal(testContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: 0},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// testTSA answers requests with the token built by answer from the request.
+func testTSA(t *testing.T, answer func(req timeStampReq) []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req timeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			t.Error(err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(answer(req))
+	}))
+}
+
+func TestRequestTimestamp(t *testing.T) {
+	data := []byte("document")
+	hash := sha256.Sum256(data)
+	tests := []struct {
+		name   string
+		answer func(req timeStampReq) []byte
+		err    string
+	}{
+		{"valid", func(req timeStampReq) []byte {
+			return testTimestampResp(t, req.MessageImprint, req.Nonce)
+		}, ""},
+		{"canned nonce", func(req timeStampReq) []byte {
+			return testTimestampResp(t, req.MessageImprint, big.NewInt(7))
+		}, "tsa token nonce mismatch"},
+		{"no nonce", func(req timeStampReq) []byte {
+			return testTimestampResp(t, req.MessageImprint, nil)
+		}, "tsa token nonce mismatch"},
+		{"other hash", func(req timeStampReq) []byte {
+			imprint := req.MessageImprint
+			imprint.HashedMessage = make([]byte, len(hash))
+			return testTimestampResp(t, imprint, req.Nonce)
+		}, "tsa token hash mismatch"},
+		{"other algorithm", func(req timeStampReq) []byte {
+			imprint := req.MessageImprint
+			imprint.HashAlgorithm.Algorithm = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401}
+			return testTimestampResp(t, imprint, req.Nonce)
+		}, "tsa token hash mismatch"},
+	}
+	for _, test := range tests {
+		tsa := testTSA(t, test.answer)
+		token, err := RequestTimestamp(tsa.URL, data)
+		tsa.Close()
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		info, err := ParseTimestampToken(token)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if info.SerialNumber != "42" || !info.GenTime.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("%s: got %+v", test.name, info)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package filesman
+
+import (
+	pdf "github.com/unidoc/unipdf/model"
+	"math"
+)
+
+const (
+	UNIT_PT      = "pt"
+	UNIT_MM      = "mm"
+	UNIT_INCH    = "in"
+	UNIT_PERCENT = "%" // of the displayed page width for x and width, height for y
+)
+
+// Origins name the page corner, or the center, that placement coordinates
+// are measured from. From a corner, x and y go inward and place the stamp
+// corner of the same name, from the center x goes right, y goes up and the
+// stamp center is placed.
+const (
+	ORIGIN_TOP_LEFT     = "top-left"
+	ORIGIN_TOP_RIGHT    = "top-right"
+	ORIGIN_BOTTOM_LEFT  = "bottom-left"
+	ORIGIN_BOTTOM_RIGHT = "bottom-right"
+	ORIGIN_CENTER       = "center"
+)
+
+func validUnit(unit string) bool {
+	switch unit {
+	case "", UNIT_PT, UNIT_MM, UNIT_INCH, UNIT_PERCENT:
+		return true
+	}
+	return false
+}
+
+func validOrigin(origin string) bool {
+	switch origin {
+	case "", ORIGIN_TOP_LEFT, ORIGIN_TOP_RIGHT, ORIGIN_BOTTOM_LEFT, ORIGIN_BOTTOM_RIGHT, ORIGIN_CENTER:
+		return true
+	}
+	return false
+}
+
+// placeable is a stamp the page layout can size, move and turn.
+type placeable interface {
+	positionable
+	SetAngle(angle float64)
+	Width() float64
+	Height() float64
+}
+
+// pageFrame is the visible area of a page as a viewer displays it: the crop
+// box, or the media box, turned by the page rotation.
+type pageFrame struct {
+	mbox   pdf.PdfRectangle
+	box    pdf.PdfRectangle
+	rotate int // clockwise, 0, 90, 180 or 270
+	width  float64
+	height float64
+}
+
+func newPageFrame(page *pdf.PdfPage) (*pageFrame, error) {
+	mbox, err := page.GetMediaBox()
+	if err != nil {
+		return nil, err
+	}
+	f := &pageFrame{mbox: *mbox, box: *mbox}
+	if page.CropBox != nil {
+		f.box = *page.CropBox
+	}
+	if page.Rotate != nil {
+		f.rotate = int((*page.Rotate%360 + 360) % 360)
+	}
+	f.width, f.height = f.box.Urx-f.box.Llx, f.box.Ury-f.box.Lly
+	if f.rotate == 90 || f.rotate == 270 {
+		f.width, f.height = f.height, f.width
+	}
+	return f, nil
+}
+
+// toPoints converts v in unit to points, ref being the page dimension
+// percentages are taken of.
+func toPoints(v float64, unit string, ref float64) float64 {
+	switch unit {
+	case UNIT_MM:
+		return v * 72 / 25.4
+	case UNIT_INCH:
+		return v * 72
+	case UNIT_PERCENT:
+		return v * ref / 100
+	}
+	return v
+}
+
+// creatorPoint maps a point measured from the displayed upper left corner,
+// y growing down, to creator coordinates of the unrotated page.
+func (f *pageFrame) creatorPoint(px, py float64) (float64, float64) {
+	var ux, uy float64 // from the lower left corner of the box, y up
+	bw, bh := f.box.Urx-f.box.Llx, f.box.Ury-f.box.Lly
+	switch f.rotate {
+	case 90:
+		ux, uy = py, px
+	case 180:
+		ux, uy = bw-px, py
+	case 270:
+		ux, uy = bw-py, bh-px
+	default:
+		ux, uy = px, bh-py
+	}
+	return f.box.Llx - f.mbox.Llx + ux, f.mbox.Ury - (f.box.Lly + uy)
+}
+
+// displayBox is a box on the page as displayed, measured from its upper
+// left corner with y growing down.
+type displayBox struct {
+	left, top, right, bottom float64
+}
+
+// displayedBox maps a rectangle of the page user space to the displayed
+// page, the inverse of creatorPoint.
+func (f *pageFrame) displayedBox(r pdf.PdfRectangle) displayBox {
+	bw, bh := f.box.Urx-f.box.Llx, f.box.Ury-f.box.Lly
+	point := func(x, y float64) (float64, float64) {
+		ux, uy := x-f.box.Llx, y-f.box.Lly
+		switch f.rotate {
+		case 90:
+			return uy, ux
+		case 180:
+			return bw - ux, uy
+		case 270:
+			return bh - uy, bw - ux
+		}
+		return ux, bh - uy
+	}
+	x0, y0 := point(r.Llx, r.Lly)
+	x1, y1 := point(r.Urx, r.Ury)
+	return displayBox{
+		left:   math.Min(x0, x1),
+		top:    math.Min(y0, y1),
+		right:  math.Max(x0, x1),
+		bottom: math.Max(y0, y1),
+	}
+}
+
+// layout returns the creator position and angle that put a w by h stamp
+// where the placement unit and origin say on the displayed page, upright
+// as displayed.
+func (f *pageFrame) layout(placement *Placement, w, h float64) (float64, float64, float64) {
+	return f.layoutIn(placement, displayBox{right: f.width, bottom: f.height}, w, h)
+}
+
+// layoutIn is layout with the origin taken in box instead of the page, as
+// for anchors. Percentages remain of the page.
+func (f *pageFrame) layoutIn(placement *Placement, box displayBox, w, h float64) (float64, float64, float64) {
+	x := toPoints(placement.Xpos, placement.Unit, f.width)
+	y := toPoints(placement.Ypos, placement.Unit, f.height)
+
+	// upper left corner of the stamp on the displayed page
+	var px, py float64
+	switch placement.Origin {
+	case ORIGIN_TOP_RIGHT:
+		px, py = box.right-x-w, box.top+y
+	case ORIGIN_BOTTOM_LEFT:
+		px, py = box.left+x, box.bottom-y-h
+	case ORIGIN_BOTTOM_RIGHT:
+		px, py = box.right-x-w, box.bottom-y-h
+	case ORIGIN_CENTER:
+		px, py = (box.left+box.right)/2+x-w/2, (box.top+box.bottom)/2-y-h/2
+	default:
+		px, py = box.left+x, box.top+y
+	}
+
+	return f.place(px, py, w, h, placement.Rotation)
+}
+
+// perforationLayout returns the creator position and angle that put a w by
+// h perforation strip flush with the right edge of the displayed page, its
+// top Ypos below the top edge, its bottom Ypos above the bottom edge for the
+// bottom origins, or its center Ypos above the page center for
+// ORIGIN_CENTER.
+func (f *pageFrame) perforationLayout(placement *Placement, w, h float64) (float64, float64, float64) {
+	y := toPoints(placement.Ypos, placement.Unit, f.height)
+	var py float64
+	switch placement.Origin {
+	case ORIGIN_BOTTOM_LEFT, ORIGIN_BOTTOM_RIGHT:
+		py = f.height - y - h
+	case ORIGIN_CENTER:
+		py = f.height/2 - y - h/2
+	default:
+		py = y
+	}
+	return f.place(f.width-w, py, w, h, 0)
+}
+
+// place returns the creator position and angle of a w by h stamp with its
+// upper left corner at px, py on the displayed page, turned by rotation
+// from upright as displayed.
+func (f *pageFrame) place(px, py, w, h, rotation float64) (float64, float64, float64) {
+	cx, cy := f.creatorPoint(px+w/2, py+h/2)
+	angle := rotation + float64(f.rotate)
+	x, y := rotatedPos(cx, cy, w, h, angle)
+	return x, y, angle
+}
+
+// usesLayout reports whether the placement is laid out with pageFrame, else
+// Xpos and Ypos are used as plain creator coordinates.
+func (placement *Placement) usesLayout() bool {
+	return placement.Unit != "" || placement.Origin != ""
+}
@@ -0,0 +1,226 @@
+package filesman
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	pdf "github.com/unidoc/unipdf/model"
+	"net/http"
+	"time"
+)
+
+// SignatureReport is the verification result of one signature field.
+type SignatureReport struct {
+	Field          string    `json:"field"`
+	SubFilter      string    `json:"subfilter"`
+	Name           string    `json:"name"`
+	Reason         string    `json:"reason"`
+	Location       string    `json:"location"`
+	Time           time.Time `json:"time"` // claimed by the signer
+	Signer         string    `json:"signer"`
+	Issuer         string    `json:"issuer"`
+	Alg            string    `json:"alg"`
+	Intact         bool      `json:"intact"`         // digest and signature valid
+	Trusted        bool      `json:"trusted"`        // certificate chains up to the trust roots
+	CoversDocument bool      `json:"coversdocument"` // nothing was appended after signing, not even a later signature
+	Errors         []string  `json:"errors"`
+}
+
+// VerifyReport lists the signatures of a PDF. Modified is set when content
+// was appended after the last signature, Valid when the PDF is signed and
+// not modified and all signatures are intact and trusted.
+type VerifyReport struct {
+	Signatures []SignatureReport `json:"signatures"`
+	Modified   bool              `json:"modified"`
+	Valid      bool              `json:"valid"`
+}
+
+// pdfWhitespace are the white-space characters of the PDF syntax.
+const pdfWhitespace = "\x00\t\n\f\r "
+
+// signedContent returns the bytes covered by a signature byte range, which
+// must leave out exactly the hex string of the signature contents.
+func signedContent(pdfData []byte, byteRange []int, contents []byte) ([]byte, int, error) {
+	if len(byteRange) != 4 || byteRange[0] != 0 {
+		return nil, 0, errors.New("invalid byte range")
+	}
+	gapStart, gapEnd := byteRange[1], byteRange[2]
+	end := gapEnd + byteRange[3]
+	if gapStart < 1 || gapEnd-gapStart < 2 || byteRange[3] < 0 || end > len(pdfData) {
+		return nil, 0, errors.New("invalid byte range")
+	}
+	if pdfData[gapStart] != '<' || pdfData[gapEnd-1] != '>' {
+		return nil, 0, errors.New("byte range does not exclude only the signature")
+	}
+	gap, err := hex.DecodeString(string(pdfData[gapStart+1 : gapEnd-1]))
+	if err != nil || !bytes.Equal(gap, contents) {
+		return nil, 0, errors.New("byte range does not exclude only the signature")
+	}
+	if !bytes.HasSuffix(bytes.TrimRight(pdfData[:gapStart], pdfWhitespace), []byte("/Contents")) {
+		return nil, 0, errors.New("byte range does not exclude only the signature")
+	}
+	content := make([]byte, 0, gapStart+byteRange[3])
+	content = append(content, pdfData[:gapStart]...)
+	content = append(content, pdfData[gapEnd:end]...)
+	return content, end, nil
+}
+
+// verifySignature checks one signature dictionary, returning the end of
+// the signed byte range.
+func verifySignature(pdfData []byte, sig *pdf.PdfSignature, roots *smx509.CertPool, report *SignatureReport) int {
+	if sig.SubFilter != nil {
+		report.SubFilter = string(*sig.SubFilter)
+	}
+	if sig.Name != nil {
+		report.Name = sig.Name.Decoded()
+	}
+	if sig.Reason != nil {
+		report.Reason = sig.Reason.Decoded()
+	}
+	if sig.Location != nil {
+		report.Location = sig.Location.Decoded()
+	}
+	if sig.M != nil {
+		if date, err := pdf.NewPdfDateFromString(sig.M.Decoded()); err == nil {
+			report.Time = date.ToGoTime()
+		}
+	}
+	if sig.ByteRange == nil || sig.Contents == nil {
+		report.Errors = append(report.Errors, "signature without byte range or contents")
+		return 0
+	}
+	byteRange, err := sig.ByteRange.ToIntegerArray()
+	if err != nil {
+		report.Errors = append(report.Errors, "invalid byte range")
+		return 0
+	}
+	content, end, err := signedContent(pdfData, byteRange, sig.Contents.Bytes())
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return 0
+	}
+
+	info, err := VerifyDetached(sig.Contents.Bytes(), content)
+	report.Alg = info.Alg
+	if info.Cert != nil {
+		report.Signer = info.Cert.Subject.CommonName
+		report.Issuer = info.Cert.Issuer.CommonName
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.Intact = info.Intact
+
+	// the signing time is claimed by the signer, the chain must be valid now
+	if err := info.VerifyChain(roots, time.Now()); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		report.Trusted = true
+	}
+	return end
+}
+
+// VerifyPdf checks all signature fields of the pdf against the trust roots.
+func VerifyPdf(pdfData []byte, roots *smx509.CertPool) (*VerifyReport, error) {
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	return verifyPdfReader(pdfReader, pdfData, roots), nil
+}
+
+// verifyPdfReader checks the signature fields read by pdfReader from
+// pdfData.
+func verifyPdfReader(pdfReader *pdf.PdfReader, pdfData []byte, roots *smx509.CertPool) *VerifyReport {
+	report := &VerifyReport{Signatures: []SignatureReport{}}
+	if pdfReader.AcroForm == nil {
+		return report
+	}
+
+	// trailing line ends after %%EOF do not count as modification
+	size := len(bytes.TrimRight(pdfData, "\r\n"))
+	signedEnd, intactEnd := 0, 0
+	var ends []int
+	for _, field := range pdfReader.AcroForm.AllFields() {
+		sigField, ok := field.GetContext().(*pdf.PdfFieldSignature)
+		if !ok || sigField.V == nil {
+			continue
+		}
+		r := SignatureReport{Field: field.PartialName(), Errors: []string{}}
+		end := verifySignature(pdfData, sigField.V, roots, &r)
+		r.CoversDocument = end >= size
+		if end > signedEnd {
+			signedEnd = end
+		}
+		if r.Intact && end > intactEnd {
+			intactEnd = end
+		}
+		ends = append(ends, end)
+		report.Signatures = append(report.Signatures, r)
+	}
+	// revisions appended after a signature are fine when an intact later
+	// signature covers them, as when signing a signed pdf again
+	for i, end := range ends {
+		if end > 0 && end < size && intactEnd < size {
+			report.Signatures[i].Errors = append(report.Signatures[i].Errors, "modified after signing")
+		}
+	}
+
+	report.Modified = len(report.Signatures) > 0 && signedEnd < size
+	report.Valid = len(report.Signatures) > 0 && !report.Modified
+	for _, r := range report.Signatures {
+		if !r.Intact || !r.Trusted {
+			report.Valid = false
+		}
+	}
+	return report
+}
+
+// Verify checks the signatures of a stored pdf named by pdf, or of a pdf
+// uploaded as the pdf file field.
+func (filesman *Filesman) Verify(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	var pdfData []byte
+	if pdffile, ok := c.GetPostForm("pdf"); ok {
+		pdffile, err := GenFilename(c, pdffile)
+		if err != nil {
+			return
+		}
+		pdfData, err = filesman.ReadFile(pdffile)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Can not read pdf",
+			})
+			return
+		}
+	} else {
+		var err error
+		pdfData, err = filesman.formFile(c, "pdf")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	report, err := VerifyPdf(pdfData, filesman.TrustRoots)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Invalid pdf",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "ok",
+		"valid":      report.Valid,
+		"modified":   report.Modified,
+		"signatures": report.Signatures,
+	})
+}
@@ -0,0 +1,131 @@
+package filesman
+
+import (
+	"bytes"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"testing"
+)
+
+func TestSignedContent(t *testing.T) {
+	contents := []byte{0x0a, 0x0b}
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"valid", "<</Contents <0a0b> /M (x)>>", ""},
+		{"valid space", "<</Contents\n <0A0B>>>", ""},
+		{"other contents", "<</Contents <0a0c> /M (x)>>", "byte range does not exclude only the signature"},
+		{"not hex", "<</Contents (0a0b) /M (x)>>", "byte range does not exclude only the signature"},
+		{"other key", "<</Reason <0a0b> /M (x)>>", "byte range does not exclude only the signature"},
+	}
+	for _, test := range tests {
+		data := []byte(test.data)
+		// the gap is the string after the dictionary start
+		gapStart := 2 + bytes.IndexAny(data[2:], "<(")
+		gapEnd := gapStart + 6
+		content, end, err := signedContent(data, []int{0, gapStart, gapEnd, len(data) - gapEnd}, contents)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		want := append(append([]byte{}, data[:gapStart]...), data[gapEnd:]...)
+		if !bytes.Equal(content, want) || end != len(data) {
+			t.Errorf("%s: %q, %d", test.name, content, end)
+		}
+	}
+
+	data := []byte("<</Contents <0a0b>>>")
+	for _, byteRange := range [][]int{
+		{0, 12, 18},
+		{1, 12, 18, 2},
+		{0, 12, 18, 3},
+		{0, 12, 13, 7},
+		{0, 12, 18, -1},
+	} {
+		if _, _, err := signedContent(data, byteRange, contents); err == nil || err.Error() != "invalid byte range" {
+			t.Errorf("byte range %v: error %v", byteRange, err)
+		}
+	}
+}
+
+func TestVerifyPdfSignedTwice(t *testing.T) {
+	signer, roots := testSigner(t, SIGN_SM2)
+	once, err := SignPdf(testPdf(t, 1), signer, SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := SignPdf(once, signer, SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyPdf(twice, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Signatures) != 2 {
+		t.Fatalf("%d signatures", len(report.Signatures))
+	}
+	covering := 0
+	for _, r := range report.Signatures {
+		if !r.Intact || !r.Trusted || len(r.Errors) > 0 {
+			t.Errorf("%+v", r)
+		}
+		if r.CoversDocument {
+			covering++
+		}
+	}
+	if covering != 1 {
+		t.Errorf("%d signatures cover the document, want 1", covering)
+	}
+	if !report.Valid || report.Modified {
+		t.Errorf("valid %v, modified %v", report.Valid, report.Modified)
+	}
+
+	// a revision after the last signature is not covered by any
+	appended := append(append([]byte{}, twice...), "\n% appended\n"...)
+	report, err = VerifyPdf(appended, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || !report.Modified {
+		t.Errorf("appended: valid %v, modified %v", report.Valid, report.Modified)
+	}
+	for _, r := range report.Signatures {
+		if !r.Intact || len(r.Errors) != 1 || r.Errors[0] != "modified after signing" {
+			t.Errorf("appended: %+v", r)
+		}
+	}
+}
+
+func TestVerifyPdfUntrusted(t *testing.T) {
+	signer, _ := testSigner(t, SIGN_RSA)
+	_, otherRoots := testSigner(t, SIGN_RSA)
+	signed, err := SignPdf(testPdf(t, 1), signer, SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, roots := range []*smx509.CertPool{otherRoots, nil} {
+		report, err := VerifyPdf(signed, roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Signatures) != 1 || !report.Signatures[0].Intact || report.Signatures[0].Trusted || report.Valid {
+			t.Errorf("roots %v: %+v", roots != nil, report)
+		}
+	}
+	report, err := VerifyPdf(testPdf(t, 1), otherRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Signatures) != 0 || report.Valid || report.Modified {
+		t.Errorf("unsigned: %+v", report)
+	}
+}
@@ -0,0 +1,389 @@
+package filesman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/minio/sha256-simd"
+	"github.com/unidoc/unipdf/contentstream"
+	"github.com/unidoc/unipdf/core"
+	"github.com/unidoc/unipdf/creator"
+	pdf "github.com/unidoc/unipdf/model"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// MAX_WATERMARK_TILES limits the tiles of a tiled watermark on a page.
+const MAX_WATERMARK_TILES = 1000
+
+var errWatermarkTiles = fmt.Errorf("Watermark needs more than %d tiles a page", MAX_WATERMARK_TILES)
+
+// Watermark is drawn centered on each selected page, or tiled over it.
+type Watermark struct {
+	Text     string // may use the stamp variables, see stampText
+	Image    []byte // used when Text is empty
+	Font     string
+	FontSize float64 // 48 when zero
+	Color    string  // "#rrggbb", gray when empty
+	Width    float64 // image width, half the page width when zero
+	Opacity  float64 // 0 to 1, 0.3 when zero
+	Angle    float64 // degrees counter-clockwise
+	Tile     bool
+	Spacing  float64 // gap between tiles, 40 when zero
+	Page     PageSelector
+}
+
+type positionable interface {
+	creator.Drawable
+	SetPos(x, y float64)
+}
+
+// drawer is a creator or block to draw on.
+type drawer interface {
+	Draw(d creator.Drawable) error
+}
+
+// rotatedPos returns the position of a w by h box rotated by angle about its
+// upper left corner, as the creator does, so that it is centered on cx, cy.
+// All in creator coordinates with y growing down.
+func rotatedPos(cx, cy, w, h, angle float64) (float64, float64) {
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	dx := w/2*cos + h/2*sin
+	dy := w/2*sin - h/2*cos
+	return cx - dx, cy + dy
+}
+
+// translucent returns a page sized block of what draw draws on it, with the
+// fill and stroke alpha set to opacity through an ExtGState as
+// Image.SetOpacity does.
+func translucent(pw, ph, opacity float64, draw func(blk *creator.Block) error) (*creator.Block, error) {
+	page := pdf.NewPdfPage()
+	page.MediaBox = &pdf.PdfRectangle{Urx: pw, Ury: ph}
+	// equal opacities share the state when merged into the page
+	name := core.PdfObjectName(fmt.Sprintf("FmAlpha%04d", int(math.Round(opacity*1000))))
+	gs := core.MakeDict()
+	gs.Set("ca", core.MakeFloat(opacity))
+	gs.Set("CA", core.MakeFloat(opacity))
+	if err := page.AddExtGState(name, gs); err != nil {
+		return nil, err
+	}
+	blk, err := creator.NewBlockFromPage(page)
+	if err != nil {
+		return nil, err
+	}
+	if err := draw(blk); err != nil {
+		return nil, err
+	}
+	// set after drawing, which wraps the contents so far in q Q
+	ops := blk.GetContents()
+	alpha := contentstream.ContentStreamOperations{}
+	alpha.Add_gs(name)
+	*ops = append(alpha, *ops...)
+	blk.SetPos(0, 0)
+	return blk, nil
+}
+
+// watermarkCenters returns the centers to draw a w by h watermark at,
+// errWatermarkTiles when tiling takes more than MAX_WATERMARK_TILES.
+func watermarkCenters(pw, ph, w, h float64, wm *Watermark) ([][2]float64, error) {
+	if !wm.Tile {
+		return [][2]float64{{pw / 2, ph / 2}}, nil
+	}
+	spacing := wm.Spacing
+	if spacing <= 0 {
+		spacing = 40
+	}
+	sin, cos := math.Sincos(wm.Angle * math.Pi / 180)
+	stepx := math.Abs(w*cos) + math.Abs(h*sin) + spacing
+	stepy := math.Abs(w*sin) + math.Abs(h*cos) + spacing
+
+	var centers [][2]float64
+	for row := 0; float64(row)*stepy < ph+stepy; row++ {
+		// stagger the rows
+		offset := float64(row%2) * stepx / 2
+		for x := offset; x < pw+stepx; x += stepx {
+			if len(centers) == MAX_WATERMARK_TILES {
+				return nil, errWatermarkTiles
+			}
+			centers = append(centers, [2]float64{x, float64(row) * stepy})
+		}
+	}
+	return centers, nil
+}
+
+// AddWatermarkToPdf draws a text or image watermark on the selected pages,
+// all pages when wm.Page is zero.
+func AddWatermarkToPdf(pdfData []byte, wm Watermark, opts StampOptions) ([]byte, error) {
+	c := creator.New()
+	sha256sum, sm3sum := sourceHashes(pdfData)
+
+	opacity := wm.Opacity
+	if opacity <= 0 {
+		opacity = 0.3
+	}
+	fontsize := wm.FontSize
+	if fontsize <= 0 {
+		fontsize = 48
+	}
+
+	var img *creator.Image
+	var font *pdf.PdfFont
+	var color creator.Color
+	var err error
+	if wm.Text != "" {
+		font, err = loadFont(opts.FontDir, wm.Font)
+		if err != nil {
+			return nil, err
+		}
+		colorstr := wm.Color
+		if colorstr == "" {
+			colorstr = "#808080"
+		}
+		color, err = textColor(colorstr)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(wm.Image) > 0 {
+		img, err = c.NewImageFromData(wm.Image)
+		if err != nil {
+			return nil, err
+		}
+		img.SetOpacity(opacity)
+		if wm.Angle != 0 {
+			img.SetAngle(wm.Angle)
+		}
+	} else {
+		return nil, errors.New("watermark needs text or image")
+	}
+
+	pdfReader, err := pdf.NewPdfReader(bytes.NewReader(pdfData))
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := pdfReader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	sel := wm.Page
+	if sel.IsZero() {
+		sel, _ = ParsePageSelector("all")
+	}
+	pages, err := sel.Pages(numPages)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[int]bool)
+	for _, n := range pages {
+		selected[n] = true
+	}
+
+	for i := 0; i < numPages; i++ {
+		page, err := pdfReader.GetPage(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		err = c.AddPage(page)
+		if err != nil {
+			return nil, err
+		}
+		if !selected[i+1] {
+			continue
+		}
+
+		ctx := c.Context()
+		var d positionable
+		var w, h float64
+		if img != nil {
+			width := wm.Width
+			if width <= 0 {
+				width = ctx.PageWidth / 2
+			}
+			img.ScaleToWidth(width)
+			d, w, h = img, img.Width(), img.Height()
+		} else {
+			p := c.NewParagraph(stampText(wm.Text, opts, sha256sum, sm3sum, i+1, numPages))
+			p.SetFont(font)
+			p.SetFontSize(fontsize)
+			p.SetColor(color)
+			p.SetEnableWrap(false)
+			if wm.Angle != 0 {
+				p.SetAngle(wm.Angle)
+			}
+			d, w, h = p, p.Width(), p.Height()
+		}
+
+		centers, err := watermarkCenters(ctx.PageWidth, ctx.PageHeight, w, h, &wm)
+		if err != nil {
+			return nil, err
+		}
+		draw := func(target drawer) error {
+			for _, center := range centers {
+				x, y := rotatedPos(center[0], center[1], w, h, wm.Angle)
+				d.SetPos(x, y)
+				if err := target.Draw(d); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if img != nil {
+			err = draw(c)
+		} else {
+			// paragraphs have no opacity of their own
+			var text *creator.Block
+			text, err = translucent(ctx.PageWidth, ctx.PageHeight, opacity, func(blk *creator.Block) error {
+				return draw(blk)
+			})
+			if err == nil {
+				err = c.Draw(text)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err = c.Write(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (filesman *Filesman) Watermark(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	pdffile, ok := c.GetPostForm("pdf")
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params pdf error",
+		})
+		return
+	}
+	pdffile, err := GenFilename(c, pdffile)
+	if err != nil {
+		return
+	}
+
+	wm := Watermark{
+		Text:  c.PostForm("text"),
+		Font:  c.PostForm("font"),
+		Color: c.PostForm("color"),
+	}
+	if image := c.PostForm("image"); wm.Text == "" && image != "" {
+		image, err = GenFilename(c, image)
+		if err != nil {
+			return
+		}
+		wm.Image, err = filesman.ReadFile(image)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Can not read image",
+			})
+			return
+		}
+	}
+	if wm.Text == "" && wm.Image == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params text error",
+		})
+		return
+	}
+
+	floats := []struct {
+		name  string
+		value *float64
+		def   float64
+	}{
+		{"fontsize", &wm.FontSize, 0},
+		{"width", &wm.Width, 0},
+		{"opacity", &wm.Opacity, 0},
+		{"angle", &wm.Angle, 45},
+		{"spacing", &wm.Spacing, 0},
+	}
+	for _, f := range floats {
+		*f.value, err = paramFloat(c.PostForm(f.name), f.def)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params " + f.name + " error",
+			})
+			return
+		}
+	}
+	if wm.Opacity < 0 || wm.Opacity > 1 {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Params opacity error",
+		})
+		return
+	}
+	if tile := c.PostForm("tile"); tile != "" {
+		wm.Tile, err = strconv.ParseBool(tile)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params tile error",
+			})
+			return
+		}
+	}
+	if page := c.PostForm("page"); page != "" {
+		wm.Page, err = ParsePageSelector(page)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "error",
+				"message": "Params page error",
+			})
+			return
+		}
+	}
+
+	pdfData, err := filesman.ReadFile(pdffile)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": "Can not read pdf",
+		})
+		return
+	}
+
+	// the watermark shows the address of the caller
+	addr, _ := SplitFilename(pdffile)
+	opts := StampOptions{Addr: addr, FontDir: filesman.FontDir}
+	if meta, err := filesman.ReadMeta(pdffile); err == nil {
+		opts.Time = meta.Created
+	}
+	out, err := AddWatermarkToPdf(pdfData, wm, opts)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "error",
+			"message": stampErrorMessage(err, "Watermark error"),
+		})
+		return
+	}
+
+	hash := sha256.Sum256([]byte(pdffile + "watermark" + c.Request.PostForm.Encode()))
+	outfile := fmt.Sprintf("%x", hash) + ".pdf"
+	outfileReal, err := GenFilename(c, outfile)
+	if err != nil {
+		return
+	}
+	if _, err := filesman.StoreFile(outfileReal, out, PDF_TYPE, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Can not write file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "ok",
+		"resultfile": outfile,
+	})
+}